@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// BatchHandlerFn handles a batch of events, events are in stream order.
+type BatchHandlerFn[T any, K any] func(ctx context.Context, events []StreamEvent[T, K]) error
+
+// BatchOptions configures how events are grouped before being handled.
+type BatchOptions struct {
+	// MaxSize is the maximum number of events in a batch, default 100.
+	MaxSize int
+	// MaxWait is the maximum time a batch is kept open after its first event, default 1s.
+	// Since the stream is polled, a batch may be flushed after up to MaxWait plus the
+	// change stream MaxAwaitTime.
+	MaxWait time.Duration
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxSize <= 0 {
+		o.MaxSize = 100
+	}
+	if o.MaxWait <= 0 {
+		o.MaxWait = time.Second
+	}
+	return o
+}
+
+// ConsumeBatchHandler calls handler with batches of events of the change stream.
+// The offset of the last event of a batch is committed only after the whole batch is handled.
+// Reconnects and invalidate events are handled like in ConsumeHandler.
+func (c *Consumer[T, K]) ConsumeBatchHandler(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, batch BatchOptions, handler BatchHandlerFn[T, K]) error {
+	batch = batch.withDefaults()
+	return c.run(ctx, func(ctx context.Context, start *streamStart) (bool, error) {
+		return c.consumeBatchHandler(ctx, start, streamOptions, batch, handler)
+	})
+}
+
+func (c *Consumer[T, K]) consumeBatchHandler(ctx context.Context, start *streamStart, streamOptions *options.ChangeStreamOptionsBuilder, batch BatchOptions, handler BatchHandlerFn[T, K]) (bool, error) {
+	stream, err := c.getStream(ctx, start, cloneStreamOptions(streamOptions))
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+	return c.consumeBatch(ctx, changeStream{stream}, batch, handler)
+}
+
+// consumeBatch groups the events of source and handles them until source is closed.
+func (c *Consumer[T, K]) consumeBatch(ctx context.Context, source eventSource, batch BatchOptions, handler BatchHandlerFn[T, K]) (bool, error) {
+	progressed := false
+	events := make([]StreamEvent[T, K], 0, batch.MaxSize)
+	raws := make([]bson.Raw, 0, batch.MaxSize)
+	var deadline time.Time
+	inv := &invalidation{}
+	for {
+		closed := false
+		if source.TryNext(ctx) {
+			doc := StreamEvent[T, K]{}
+			if err := decodeEvent(source, &doc); err != nil {
+				return progressed, err
+			}
+			c.received(doc)
+			inv.observe(doc.OperationType, Namespace(doc.NS), doc.To, doc.GetStreamOffset())
+			events = append(events, doc)
+			raws = append(raws, slices.Clone(source.Raw()))
+			if len(events) == 1 {
+				deadline = time.Now().Add(batch.MaxWait)
+			}
+		} else if err := source.Err(); err != nil {
+			return progressed, err
+		} else {
+			closed = source.ID() == 0
+		}
+		full := len(events) >= batch.MaxSize || !time.Now().Before(deadline)
+		if len(events) > 0 && (closed || full) {
+			if err := c.handleBatch(ctx, raws, events, handler); err != nil {
+				return progressed, err
+			}
+			progressed = true
+			events = make([]StreamEvent[T, K], 0, batch.MaxSize)
+			raws = make([]bson.Raw, 0, batch.MaxSize)
+			deadline = time.Time{}
+		}
+		if closed {
+			return progressed, c.invalidated(ctx, inv)
+		}
+	}
+}
+
+// handleBatch calls handler applying the failure policy, then commits the offset of the last event.
+// When attempts are exhausted every event of the batch is dead lettered.
+func (c *Consumer[T, K]) handleBatch(ctx context.Context, raws []bson.Raw, events []StreamEvent[T, K], handler BatchHandlerFn[T, K]) error {
+	attempts, handlerErr := c.failure.retry(ctx, c.measureHandler(OperationBatch, func(ctx context.Context) error {
+		return handler(ctx, events)
+	}))
+	if handlerErr != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for i, event := range events {
+			err := c.deadLetter(ctx, DeadLetter{
+				Event:         raws[i],
+				StreamEvent:   event,
+				OperationType: event.OperationType,
+				Offset:        *event.GetStreamOffset(),
+				Attempts:      attempts,
+				Err:           handlerErr,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.commitOffset(ctx, *events[len(events)-1].GetStreamOffset())
+}
@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBatchOptions_withDefaults(t *testing.T) {
+	got := BatchOptions{}.withDefaults()
+	if got.MaxSize != 100 || got.MaxWait != time.Second {
+		t.Errorf("withDefaults() = %+v", got)
+	}
+	got = BatchOptions{MaxSize: 10, MaxWait: time.Minute}.withDefaults()
+	if got.MaxSize != 10 || got.MaxWait != time.Minute {
+		t.Errorf("withDefaults() = %+v", got)
+	}
+}
+
+func TestConsumer_handleBatch(t *testing.T) {
+	events := make([]StreamEvent[any, any], 3)
+	raws := make([]bson.Raw, 3)
+	for i, token := range []string{"a", "b", "c"} {
+		events[i].ID.Data = token
+	}
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	om := &countingOffsetManager{}
+	c := &Consumer[any, any]{tokenManager: om, failure: FailurePolicy{MaxAttempts: 1, Backoff: backoff}}
+	var got []StreamEvent[any, any]
+	err := c.handleBatch(context.Background(), raws, events, func(ctx context.Context, events []StreamEvent[any, any]) error {
+		got = events
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("handleBatch() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("handleBatch() handled %d events, want 3", len(got))
+	}
+	if len(om.offsets) != 1 || om.offsets[0].ResumeToken != "c" {
+		t.Errorf("handleBatch() committed %+v, want only last offset", om.offsets)
+	}
+
+	sink := &recordingSink{}
+	om = &countingOffsetManager{}
+	c = &Consumer[any, any]{tokenManager: om, failure: FailurePolicy{MaxAttempts: 2, Backoff: backoff, DeadLetter: sink}}
+	err = c.handleBatch(context.Background(), raws, events, func(ctx context.Context, events []StreamEvent[any, any]) error {
+		return errors.New("fail")
+	})
+	if err != nil {
+		t.Fatalf("handleBatch() error = %v", err)
+	}
+	if len(sink.letters) != 3 {
+		t.Errorf("handleBatch() sent %d dead letters, want 3", len(sink.letters))
+	}
+	if len(om.offsets) != 1 || om.offsets[0].ResumeToken != "c" {
+		t.Errorf("handleBatch() committed %+v, want only last offset", om.offsets)
+	}
+}
+
+func TestConsumer_consumeBatch(t *testing.T) {
+	events := func(delays ...time.Duration) []sourceEvent {
+		var events []sourceEvent
+		for i, after := range delays {
+			events = append(events, sourceEvent{raw: insertEvent(fmt.Sprintf("%02d", i), "doc"), after: after})
+		}
+		return events
+	}
+	tests := []struct {
+		name        string
+		batch       BatchOptions
+		source      *sliceSource
+		wantBatches [][]string
+		wantErr     error
+	}{
+		{
+			name:        "flushes full batches and the last one on close",
+			batch:       BatchOptions{MaxSize: 2, MaxWait: time.Hour},
+			source:      &sliceSource{events: events(0, 0, 0, 0, 0), closed: true},
+			wantBatches: [][]string{{"00", "01"}, {"02", "03"}, {"04"}},
+		},
+		{
+			name:        "flushes after MaxWait while the stream is idle",
+			batch:       BatchOptions{MaxSize: 10, MaxWait: 20 * time.Millisecond},
+			source:      &sliceSource{events: events(0, 0)},
+			wantBatches: [][]string{{"00", "01"}},
+			wantErr:     context.Canceled,
+		},
+		{
+			name:        "MaxWait starts from the first event of each batch",
+			batch:       BatchOptions{MaxSize: 2, MaxWait: 200 * time.Millisecond},
+			source:      &sliceSource{events: events(0, 0, 150*time.Millisecond, 100*time.Millisecond), closed: true},
+			wantBatches: [][]string{{"00", "01"}, {"02", "03"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			om := &countingOffsetManager{}
+			c := &Consumer[any, string]{tokenManager: om, failure: FailurePolicy{MaxAttempts: 1}}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var batches [][]string
+			_, err := c.consumeBatch(ctx, tt.source, tt.batch, func(ctx context.Context, events []StreamEvent[any, string]) error {
+				var tokens []string
+				for _, event := range events {
+					tokens = append(tokens, event.ID.Data)
+				}
+				batches = append(batches, tokens)
+				if !tt.source.closed {
+					cancel()
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("consumeBatch() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(batches, tt.wantBatches) {
+				t.Errorf("batches = %v, want %v", batches, tt.wantBatches)
+			}
+			last := tt.wantBatches[len(tt.wantBatches)-1]
+			if n := len(om.offsets); n != len(tt.wantBatches) || om.offsets[n-1].ResumeToken != last[len(last)-1] {
+				t.Errorf("committed offsets = %+v, want one per batch", om.offsets)
+			}
+		})
+	}
+}
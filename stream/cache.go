@@ -0,0 +1,314 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+	"sync"
+
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// CacheChange describes a change applied to a Cache.
+type CacheChange[T any, K comparable] struct {
+	// OperationType is insert, update, replace or delete.
+	OperationType string
+	Key           K
+	// Old is the previous value, nil for inserts.
+	Old *T
+	// New is the current value, nil for deletes.
+	New *T
+}
+
+// Cache keeps in memory the documents of a collection, keyed by _id, in sync with its change stream.
+// It is meant for small reference collections, since every document is kept in memory.
+type Cache[T any, K comparable] struct {
+	consumer *Consumer[T, K]
+	offsets  *lastOffset
+
+	mu    sync.RWMutex
+	items map[K]T
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	listenersMu sync.RWMutex
+	listeners   []func(ctx context.Context, change CacheChange[T, K])
+
+	resyncMu sync.Mutex
+	resync   context.CancelFunc
+}
+
+// NewCache returns a Cache of conf.Database.conf.Collection, which must be set.
+// Offsets are kept in memory since the cache is loaded again on each Run, so conf.TokenManager is ignored.
+func NewCache[T any, K comparable](client *mongo.Client, conf *Config) *Cache[T, K] {
+	cache := &Cache[T, K]{
+		offsets: &lastOffset{},
+		items:   map[K]T{},
+		ready:   make(chan struct{}),
+	}
+	cacheConf := *conf
+	cacheConf.TokenManager = cache.offsets
+	cacheConf.InvalidateMode = InvalidateStop
+	cacheConf.OnOffsetReset = func(ctx context.Context, previous StreamOffset, cause error) {
+		cache.requestResync()
+		if conf.OnOffsetReset != nil {
+			conf.OnOffsetReset(ctx, previous, cause)
+		}
+	}
+	cache.consumer = NewStreamConsumer[T, K](client, &cacheConf)
+	return cache
+}
+
+// OnChange registers fn to be called after each change applied to the cache.
+// Changes found reloading the collection after an invalidate event or an offset reset are notified too.
+func (c *Cache[T, K]) OnChange(fn func(ctx context.Context, change CacheChange[T, K])) {
+	c.listenersMu.Lock()
+	defer c.listenersMu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// Ready returns a channel closed once the collection is loaded for the first time.
+func (c *Cache[T, K]) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Run loads the collection and applies its changes until ctx is done or an error occurs.
+// After an invalidate event or an offset reset the collection is loaded again.
+func (c *Cache[T, K]) Run(ctx context.Context) error {
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		c.resyncMu.Lock()
+		c.resync = cancel
+		c.resyncMu.Unlock()
+
+		err := c.sync(runCtx)
+		cancel()
+		var invalidated *InvalidatedError
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case runCtx.Err() != nil, errors.As(err, &invalidated):
+			// offset reset or invalidated stream, load the collection again
+			continue
+		default:
+			return err
+		}
+	}
+}
+
+// sync loads the collection and then applies the change stream from the time the load started.
+func (c *Cache[T, K]) sync(ctx context.Context) error {
+	startAt, err := c.consumer.operationTime(ctx)
+	if err != nil {
+		return err
+	}
+	items, err := c.load(ctx)
+	if err != nil {
+		return err
+	}
+	c.replace(ctx, items)
+	if err := c.offsets.SetOffset(ctx, StreamOffset{ClusterTime: startAt}); err != nil {
+		return err
+	}
+	return c.consumer.ConsumeHandler(ctx, nil, c.apply)
+}
+
+// load reads all the documents of the collection.
+func (c *Cache[T, K]) load(ctx context.Context) (map[K]T, error) {
+	cursor, err := c.collection().Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.WithoutCancel(ctx))
+
+	items := map[K]T{}
+	for cursor.Next(ctx) {
+		var key K
+		if err := cursor.Current.Lookup("_id").Unmarshal(&key); err != nil {
+			return nil, err
+		}
+		var value T
+		if err := cursor.Decode(&value); err != nil {
+			return nil, err
+		}
+		items[key] = value
+	}
+	return items, cursor.Err()
+}
+
+// replace sets the cache content to items, notifying the differences from the previous content.
+func (c *Cache[T, K]) replace(ctx context.Context, items map[K]T) {
+	c.mu.Lock()
+	previous := c.items
+	c.items = items
+	c.mu.Unlock()
+
+	first := false
+	c.readyOnce.Do(func() {
+		first = true
+		close(c.ready)
+	})
+	if first {
+		return
+	}
+	for _, change := range diffItems(previous, items) {
+		c.notify(ctx, change)
+	}
+}
+
+// apply applies a change stream event to the cache.
+func (c *Cache[T, K]) apply(ctx context.Context, event StreamEvent[T, K]) error {
+	key := event.DocumentKey.ID
+	change := CacheChange[T, K]{OperationType: event.OperationType, Key: key}
+	switch event.OperationType {
+	case OperationInsert, OperationReplace:
+		value := event.FullDocument
+		change.New = &value
+	case OperationUpdate:
+		c.mu.RLock()
+		prev, ok := c.items[key]
+		c.mu.RUnlock()
+		var value T
+		var err error
+		if ok && event.UpdateDescription != nil {
+			value, err = ApplyUpdateTo(prev, *event.UpdateDescription)
+		} else {
+			ok, err = c.findOne(ctx, key, &value)
+			if !ok {
+				// deleted after the update, the delete event follows
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		change.New = &value
+	case OperationDelete:
+	default:
+		return nil
+	}
+
+	c.mu.Lock()
+	if prev, ok := c.items[key]; ok {
+		change.Old = &prev
+	}
+	if change.New != nil {
+		c.items[key] = *change.New
+	} else {
+		delete(c.items, key)
+	}
+	c.mu.Unlock()
+	c.notify(ctx, change)
+	return nil
+}
+
+// findOne reads the current version of the document with given key, it returns false if it does not exist.
+func (c *Cache[T, K]) findOne(ctx context.Context, key K, value *T) (bool, error) {
+	err := c.collection().FindOne(ctx, query.NewFilterBuilder().Eq("_id", key).Build()).Decode(value)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Cache[T, K]) collection() *mongo.Collection {
+	return c.consumer.client.Database(c.consumer.database).Collection(c.consumer.collection)
+}
+
+func (c *Cache[T, K]) notify(ctx context.Context, change CacheChange[T, K]) {
+	c.listenersMu.RLock()
+	defer c.listenersMu.RUnlock()
+	for _, fn := range c.listeners {
+		fn(ctx, change)
+	}
+}
+
+// requestResync stops the running stream so that Run loads the collection again.
+func (c *Cache[T, K]) requestResync() {
+	c.resyncMu.Lock()
+	defer c.resyncMu.Unlock()
+	if c.resync != nil {
+		c.resync()
+	}
+}
+
+// Get returns the cached value of key.
+func (c *Cache[T, K]) Get(key K) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.items[key]
+	return value, ok
+}
+
+// Len returns the number of cached documents.
+func (c *Cache[T, K]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+// Range calls fn for each cached document until it returns false.
+// The cache is read locked while iterating, so fn must not modify it.
+func (c *Cache[T, K]) Range(fn func(key K, value T) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for key, value := range c.items {
+		if !fn(key, value) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the cached documents.
+func (c *Cache[T, K]) Snapshot() map[K]T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return maps.Clone(c.items)
+}
+
+// lastOffset is an OffsetManager keeping only the last offset in memory.
+type lastOffset struct {
+	mu     sync.Mutex
+	offset *StreamOffset
+}
+
+func (o *lastOffset) GetOffset(ctx context.Context) (*StreamOffset, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.offset == nil {
+		return nil, nil
+	}
+	offset := *o.offset
+	return &offset, nil
+}
+
+func (o *lastOffset) SetOffset(ctx context.Context, offset StreamOffset) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.offset = &offset
+	return nil
+}
+
+// diffItems returns the changes which turn previous into current.
+func diffItems[T any, K comparable](previous, current map[K]T) []CacheChange[T, K] {
+	var changes []CacheChange[T, K]
+	for key, value := range current {
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			changes = append(changes, CacheChange[T, K]{OperationType: OperationInsert, Key: key, New: &value})
+		case !reflect.DeepEqual(old, value):
+			changes = append(changes, CacheChange[T, K]{OperationType: OperationReplace, Key: key, Old: &old, New: &value})
+		}
+	}
+	for key, old := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, CacheChange[T, K]{OperationType: OperationDelete, Key: key, Old: &old})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCache_apply(t *testing.T) {
+	ctx := context.Background()
+	c := &Cache[testUser, int]{items: map[int]testUser{}}
+	var changes []CacheChange[testUser, int]
+	c.OnChange(func(ctx context.Context, change CacheChange[testUser, int]) {
+		changes = append(changes, change)
+	})
+
+	insert := StreamEvent[testUser, int]{OperationType: OperationInsert, FullDocument: testUser{Name: "john"}}
+	insert.DocumentKey.ID = 1
+	update := StreamEvent[testUser, int]{
+		OperationType:     OperationUpdate,
+		UpdateDescription: &UpdateDescription{UpdatedFields: map[string]interface{}{"name": "jack"}},
+	}
+	update.DocumentKey.ID = 1
+	replace := StreamEvent[testUser, int]{OperationType: OperationReplace, FullDocument: testUser{Name: "jim"}}
+	replace.DocumentKey.ID = 1
+	drop := StreamEvent[testUser, int]{OperationType: OperationDrop}
+	del := StreamEvent[testUser, int]{OperationType: OperationDelete}
+	del.DocumentKey.ID = 1
+
+	steps := []struct {
+		event StreamEvent[testUser, int]
+		want  *testUser
+	}{
+		{event: insert, want: &testUser{Name: "john"}},
+		{event: update, want: &testUser{Name: "jack"}},
+		{event: replace, want: &testUser{Name: "jim"}},
+		{event: drop, want: &testUser{Name: "jim"}},
+		{event: del, want: nil},
+	}
+	for _, step := range steps {
+		if err := c.apply(ctx, step.event); err != nil {
+			t.Fatalf("apply(%s) error = %v", step.event.OperationType, err)
+		}
+		got, ok := c.Get(1)
+		if (step.want == nil) == ok || (ok && got != *step.want) {
+			t.Errorf("Get() after %s = %+v, %v, want %+v", step.event.OperationType, got, ok, step.want)
+		}
+	}
+
+	if len(changes) != 4 {
+		t.Fatalf("OnChange called %d times, want 4", len(changes))
+	}
+	if changes[0].Old != nil || changes[1].Old.Name != "john" || changes[1].New.Name != "jack" || changes[3].New != nil {
+		t.Errorf("changes = %+v", changes)
+	}
+}
+
+func TestCache_read(t *testing.T) {
+	c := &Cache[testUser, int]{items: map[int]testUser{1: {Name: "a"}, 2: {Name: "b"}, 3: {Name: "c"}}}
+	snapshot := c.Snapshot()
+	snapshot[4] = testUser{Name: "d"}
+	if c.Len() != 3 {
+		t.Errorf("Len() = %d, Snapshot() is not a copy", c.Len())
+	}
+	visited := 0
+	c.Range(func(key int, value testUser) bool {
+		visited++
+		return visited < 2
+	})
+	if visited != 2 {
+		t.Errorf("Range() visited %d documents, want 2", visited)
+	}
+}
+
+func TestDiffItems(t *testing.T) {
+	previous := map[int]testUser{1: {Name: "a"}, 2: {Name: "b"}, 3: {Name: "c"}}
+	current := map[int]testUser{1: {Name: "a"}, 2: {Name: "B"}, 4: {Name: "d"}}
+
+	changes := diffItems(previous, current)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	got := make([]string, len(changes))
+	for i, change := range changes {
+		got[i] = change.OperationType
+	}
+	want := []string{OperationReplace, OperationDelete, OperationInsert}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffItems() = %v, want %v", got, want)
+	}
+	if changes[0].Old.Name != "b" || changes[0].New.Name != "B" {
+		t.Errorf("diffItems() replace = %+v", changes[0])
+	}
+}
+
+func TestLastOffset(t *testing.T) {
+	ctx := context.Background()
+	o := &lastOffset{}
+	if got, err := o.GetOffset(ctx); got != nil || err != nil {
+		t.Fatalf("GetOffset() = %v, %v, want nil before any commit", got, err)
+	}
+	o.SetOffset(ctx, StreamOffset{ResumeToken: "1"})
+	o.SetOffset(ctx, StreamOffset{ResumeToken: "2"})
+	got, _ := o.GetOffset(ctx)
+	got.ResumeToken = "changed"
+	if got, _ := o.GetOffset(ctx); got.ResumeToken != "2" {
+		t.Errorf("GetOffset() = %+v, want the last offset", got)
+	}
+}
@@ -0,0 +1,153 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdEncoderDecoder encodes events with zstd. The zero value is ready to use and safe for concurrent use,
+// the underlying encoder and decoder are created once and shared.
+type ZstdEncoderDecoder struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (d *ZstdEncoderDecoder) init() error {
+	d.once.Do(func() {
+		if d.encoder, d.err = zstd.NewWriter(nil); d.err != nil {
+			return
+		}
+		d.decoder, d.err = zstd.NewReader(nil)
+	})
+	return d.err
+}
+
+func (d *ZstdEncoderDecoder) Encode(raw []byte) ([]byte, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.encoder.EncodeAll(raw, nil), nil
+}
+
+func (d *ZstdEncoderDecoder) Decode(raw []byte) ([]byte, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.decoder.DecodeAll(raw, nil)
+}
+
+// SnappyEncoderDecoder encodes events with the snappy block format.
+type SnappyEncoderDecoder struct {
+}
+
+func (d *SnappyEncoderDecoder) Encode(raw []byte) ([]byte, error) {
+	return snappy.Encode(nil, raw), nil
+}
+
+func (d *SnappyEncoderDecoder) Decode(raw []byte) ([]byte, error) {
+	return snappy.Decode(nil, raw)
+}
+
+// Codec identifies the encoding of a framed event.
+type Codec byte
+
+const (
+	CodecNone Codec = iota
+	CodecGzip
+	CodecZstd
+	CodecSnappy
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	case CodecZstd:
+		return "zstd"
+	case CodecSnappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("codec(%d)", byte(c))
+	}
+}
+
+// frameMagic starts every frame, followed by the frame version and the codec.
+var frameMagic = [2]byte{'M', 'W'}
+
+const (
+	frameVersion    = 1
+	frameHeaderSize = len(frameMagic) + 2
+)
+
+var ErrInvalidFrame = errors.New("invalid event frame")
+
+var codecs = map[Codec]interface {
+	EventEncoder
+	EventDecoder
+}{
+	CodecGzip:   &GzipEncoderDecoder{},
+	CodecZstd:   &ZstdEncoderDecoder{},
+	CodecSnappy: &SnappyEncoderDecoder{},
+}
+
+// FramedEncoder encodes events with Codec prefixing them with a header which records the codec,
+// so that FramedDecoder can decode them without knowing it.
+type FramedEncoder struct {
+	Codec Codec
+}
+
+func (e *FramedEncoder) Encode(raw []byte) ([]byte, error) {
+	payload := raw
+	if e.Codec != CodecNone {
+		codec, ok := codecs[e.Codec]
+		if !ok {
+			return nil, fmt.Errorf("unknown codec %v", e.Codec)
+		}
+		var err error
+		if payload, err = codec.Encode(raw); err != nil {
+			return nil, err
+		}
+	}
+	b := make([]byte, 0, frameHeaderSize+len(payload))
+	b = append(b, frameMagic[:]...)
+	b = append(b, frameVersion, byte(e.Codec))
+	return append(b, payload...), nil
+}
+
+// FramedDecoder decodes events encoded by FramedEncoder with any codec.
+type FramedDecoder struct {
+}
+
+func (d *FramedDecoder) Decode(raw []byte) ([]byte, error) {
+	codec, payload, err := ParseFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+	if codec == CodecNone {
+		return payload, nil
+	}
+	decoder, ok := codecs[codec]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown codec %v", ErrInvalidFrame, codec)
+	}
+	return decoder.Decode(payload)
+}
+
+// ParseFrame returns the codec and the encoded payload of a frame.
+func ParseFrame(raw []byte) (Codec, []byte, error) {
+	if len(raw) < frameHeaderSize || raw[0] != frameMagic[0] || raw[1] != frameMagic[1] {
+		return CodecNone, nil, ErrInvalidFrame
+	}
+	if raw[2] != frameVersion {
+		return CodecNone, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFrame, raw[2])
+	}
+	return Codec(raw[3]), raw[frameHeaderSize:], nil
+}
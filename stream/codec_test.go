@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncoderDecoders(t *testing.T) {
+	raw := bytes.Repeat([]byte(`{"operationType":"insert","fullDocument":{"name":"john"}}`), 20)
+	tests := []struct {
+		name  string
+		codec interface {
+			EventEncoder
+			EventDecoder
+		}
+	}{
+		{name: "gzip", codec: &GzipEncoderDecoder{}},
+		{name: "zstd", codec: &ZstdEncoderDecoder{}},
+		{name: "snappy", codec: &SnappyEncoderDecoder{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.codec.Encode(raw)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if len(encoded) >= len(raw) {
+				t.Errorf("Encode() = %d bytes, want less than %d", len(encoded), len(raw))
+			}
+			decoded, err := tt.codec.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !bytes.Equal(decoded, raw) {
+				t.Errorf("Decode() = %s, want %s", decoded, raw)
+			}
+		})
+	}
+}
+
+func TestFramedEncoder(t *testing.T) {
+	raw := []byte(`{"operationType":"delete"}`)
+	decoder := &FramedDecoder{}
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecZstd, CodecSnappy} {
+		t.Run(codec.String(), func(t *testing.T) {
+			encoded, err := (&FramedEncoder{Codec: codec}).Encode(raw)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, _, err := ParseFrame(encoded)
+			if err != nil || got != codec {
+				t.Errorf("ParseFrame() = %v, %v, want %v", got, err, codec)
+			}
+			decoded, err := decoder.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !bytes.Equal(decoded, raw) {
+				t.Errorf("Decode() = %s, want %s", decoded, raw)
+			}
+		})
+	}
+}
+
+func TestFramedDecoder_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{name: "short", raw: []byte("MW")},
+		{name: "bad magic", raw: []byte("XX\x01\x00{}")},
+		{name: "bad version", raw: []byte("MW\x09\x00{}")},
+		{name: "unknown codec", raw: []byte("MW\x01\x7f{}")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (&FramedDecoder{}).Decode(tt.raw); !errors.Is(err, ErrInvalidFrame) {
+				t.Errorf("Decode() error = %v, want %v", err, ErrInvalidFrame)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ConsumeConcurrentHandler calls handler for each event of the change stream using given number of workers.
+// Events are routed to workers by a hash of DocumentKey.ID, so events of the same document are handled in order.
+// Offsets are committed up to the last event for which all previous events have been handled,
+// so that after a restart no unhandled event is skipped.
+// Reconnects and invalidate events are handled like in ConsumeHandler.
+func (c *Consumer[T, K]) ConsumeConcurrentHandler(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, workers int, handler HandlerFn[T, K]) error {
+	if workers < 1 {
+		workers = 1
+	}
+	return c.run(ctx, func(ctx context.Context, start *streamStart) (bool, error) {
+		return c.consumeConcurrentHandler(ctx, start, streamOptions, workers, handler)
+	})
+}
+
+type concurrentJob[T any, K any] struct {
+	seq   uint64
+	raw   bson.Raw
+	event StreamEvent[T, K]
+}
+
+func (c *Consumer[T, K]) consumeConcurrentHandler(ctx context.Context, start *streamStart, streamOptions *options.ChangeStreamOptionsBuilder, workers int, handler HandlerFn[T, K]) (bool, error) {
+	stream, err := c.getStream(ctx, start, cloneStreamOptions(streamOptions))
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+	return c.dispatchConcurrent(ctx, changeStream{stream}, workers, handler)
+}
+
+// dispatchConcurrent routes the events of source to workers until source is exhausted or a worker fails.
+func (c *Consumer[T, K]) dispatchConcurrent(ctx context.Context, source eventSource, workers int, handler HandlerFn[T, K]) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg         sync.WaitGroup
+		errOnce    sync.Once
+		workerErr  error
+		commitMu   sync.Mutex
+		progressMu sync.Mutex
+		progressed bool
+	)
+	mark := &watermark{}
+	inv := &invalidation{}
+	fail := func(err error) {
+		errOnce.Do(func() {
+			workerErr = err
+			cancel()
+		})
+	}
+	commit := func() error {
+		commitMu.Lock()
+		defer commitMu.Unlock()
+		seq, offset, ok := mark.uncommitted()
+		if !ok {
+			return nil
+		}
+		if err := c.commitOffset(ctx, offset); err != nil {
+			return err
+		}
+		mark.commit(seq)
+		return nil
+	}
+
+	queues := make([]chan concurrentJob[T, K], workers)
+	for i := range queues {
+		queues[i] = make(chan concurrentJob[T, K], 1)
+		wg.Add(1)
+		go func(queue <-chan concurrentJob[T, K]) {
+			defer wg.Done()
+			for job := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := c.callHandler(ctx, job.raw, job.event, handler); err != nil {
+					fail(err)
+					continue
+				}
+				mark.done(job.seq)
+				if err := commit(); err != nil {
+					fail(err)
+					continue
+				}
+				progressMu.Lock()
+				progressed = true
+				progressMu.Unlock()
+			}
+		}(queues[i])
+	}
+
+	for source.Next(ctx) {
+		doc := StreamEvent[T, K]{}
+		if err := decodeEvent(source, &doc); err != nil {
+			fail(err)
+			break
+		}
+		c.received(doc)
+		inv.observe(doc.OperationType, Namespace(doc.NS), doc.To, doc.GetStreamOffset())
+		job := concurrentJob[T, K]{
+			seq:   mark.add(*doc.GetStreamOffset()),
+			raw:   slices.Clone(source.Raw()),
+			event: doc,
+		}
+		select {
+		case queues[keyHash(doc.DocumentKey.ID)%uint32(workers)] <- job:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	streamErr := source.Err()
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	if workerErr != nil {
+		return progressed, workerErr
+	}
+	if streamErr != nil {
+		return progressed, streamErr
+	}
+	return progressed, c.invalidated(ctx, inv)
+}
+
+// keyHash returns a stable hash of a document key.
+func keyHash(key any) uint32 {
+	h := fnv.New32a()
+	t, data, err := bson.MarshalValue(key)
+	if err != nil {
+		fmt.Fprint(h, key)
+		return h.Sum32()
+	}
+	h.Write([]byte{byte(t)})
+	h.Write(data)
+	return h.Sum32()
+}
+
+// watermark tracks events handled out of order and returns the offset of the
+// last event for which all previous events have been handled.
+type watermark struct {
+	mu        sync.Mutex
+	next      uint64
+	low       uint64
+	pending   map[uint64]StreamOffset
+	handled   map[uint64]bool
+	markSeq   uint64
+	mark      StreamOffset
+	committed uint64
+}
+
+// add registers a new event and returns its sequence number.
+func (w *watermark) add(offset StreamOffset) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending == nil {
+		w.pending = make(map[uint64]StreamOffset)
+		w.handled = make(map[uint64]bool)
+	}
+	w.next++
+	if w.low == 0 {
+		w.low = w.next
+	}
+	w.pending[w.next] = offset
+	return w.next
+}
+
+// done marks the event with given sequence number as handled.
+func (w *watermark) done(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handled[seq] = true
+	for w.handled[w.low] {
+		w.markSeq, w.mark = w.low, w.pending[w.low]
+		delete(w.handled, w.low)
+		delete(w.pending, w.low)
+		w.low++
+	}
+}
+
+// uncommitted returns the watermark offset if it has not been committed yet.
+func (w *watermark) uncommitted() (uint64, StreamOffset, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.markSeq, w.mark, w.markSeq > w.committed
+}
+
+// commit records that the watermark up to seq has been committed.
+func (w *watermark) commit(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq > w.committed {
+		w.committed = seq
+	}
+}
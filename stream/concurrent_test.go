@@ -0,0 +1,235 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// sourceEvent is an event of sliceSource, available after a delay from the previous one.
+type sourceEvent struct {
+	raw   bson.Raw
+	after time.Duration
+}
+
+// sliceSource is an eventSource replaying events, once they are consumed it is closed if closed is set,
+// otherwise it stays open without events.
+type sliceSource struct {
+	events  []sourceEvent
+	closed  bool
+	last    time.Time
+	current bson.Raw
+	err     error
+}
+
+func (s *sliceSource) TryNext(ctx context.Context) bool {
+	if s.err = ctx.Err(); s.err != nil {
+		return false
+	}
+	if !s.take() {
+		// like a getMore awaiting events
+		time.Sleep(time.Millisecond)
+		return false
+	}
+	return true
+}
+
+// Next returns the available events even if ctx is done, like the driver does for the fetched ones.
+func (s *sliceSource) Next(ctx context.Context) bool {
+	for s.ID() != 0 {
+		if s.take() {
+			return true
+		}
+		if s.err = ctx.Err(); s.err != nil {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+// take moves to the next event if it is available.
+func (s *sliceSource) take() bool {
+	if len(s.events) == 0 || time.Since(s.last) < s.events[0].after {
+		return false
+	}
+	s.current, s.events = s.events[0].raw, s.events[1:]
+	s.last = time.Now()
+	return true
+}
+
+func (s *sliceSource) Decode(val any) error {
+	return bson.Unmarshal(s.current, val)
+}
+
+func (s *sliceSource) Err() error {
+	return s.err
+}
+
+func (s *sliceSource) ID() int64 {
+	if s.closed && len(s.events) == 0 {
+		return 0
+	}
+	return 1
+}
+
+func (s *sliceSource) Raw() bson.Raw {
+	return s.current
+}
+
+// insertEvent returns the raw insert event of the document key with resume token.
+func insertEvent(token, key string) bson.Raw {
+	raw, _ := bson.Marshal(bson.M{
+		"_id":           bson.M{"_data": token},
+		"operationType": OperationInsert,
+		"documentKey":   bson.M{"_id": key},
+	})
+	return raw
+}
+
+// watermarkOffsetManager fails the test if an offset is committed past an unhandled event.
+type watermarkOffsetManager struct {
+	defaultOffsetManager
+	t       *testing.T
+	mu      sync.Mutex
+	handled map[string]bool
+	offsets []string
+}
+
+func (m *watermarkOffsetManager) handle(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handled[token] = true
+}
+
+func (m *watermarkOffsetManager) SetOffset(ctx context.Context, offset StreamOffset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; fmt.Sprintf("%02d", i) <= offset.ResumeToken; i++ {
+		if !m.handled[fmt.Sprintf("%02d", i)] {
+			m.t.Errorf("offset %s committed before event %02d was handled", offset.ResumeToken, i)
+		}
+	}
+	m.offsets = append(m.offsets, offset.ResumeToken)
+	return nil
+}
+
+func TestConsumer_dispatchConcurrent(t *testing.T) {
+	source := &sliceSource{closed: true}
+	for i := range 30 {
+		source.events = append(source.events, sourceEvent{raw: insertEvent(fmt.Sprintf("%02d", i), fmt.Sprintf("doc%d", i%3))})
+	}
+	offsets := &watermarkOffsetManager{t: t, handled: map[string]bool{}}
+	c := &Consumer[any, string]{tokenManager: offsets, failure: FailurePolicy{MaxAttempts: 1}}
+
+	var mu sync.Mutex
+	order := map[string][]string{}
+	_, err := c.dispatchConcurrent(context.Background(), source, 4, func(ctx context.Context, event StreamEvent[any, string]) error {
+		// later events are faster, they would overtake earlier ones of the same document if handled concurrently
+		i, _ := strconv.Atoi(event.ID.Data)
+		time.Sleep(time.Duration(30-i) * 100 * time.Microsecond)
+		mu.Lock()
+		order[event.DocumentKey.ID] = append(order[event.DocumentKey.ID], event.ID.Data)
+		mu.Unlock()
+		offsets.handle(event.ID.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dispatchConcurrent() error = %v", err)
+	}
+	for key, tokens := range order {
+		for i := 1; i < len(tokens); i++ {
+			if tokens[i-1] > tokens[i] {
+				t.Errorf("events of %s handled in order %v", key, tokens)
+				break
+			}
+		}
+	}
+	if n := len(offsets.offsets); n == 0 || offsets.offsets[n-1] != "29" {
+		t.Errorf("committed offsets = %v, want up to 29", offsets.offsets)
+	}
+}
+
+func TestConsumer_dispatchConcurrent_workerFailure(t *testing.T) {
+	// the source stays open, the consumer must stop on its own
+	source := &sliceSource{}
+	for i := range 10 {
+		source.events = append(source.events, sourceEvent{raw: insertEvent(fmt.Sprintf("%02d", i), fmt.Sprintf("doc%d", i))})
+	}
+	offsets := &watermarkOffsetManager{t: t, handled: map[string]bool{}}
+	c := &Consumer[any, string]{tokenManager: offsets, failure: FailurePolicy{MaxAttempts: 1}}
+	fail := errors.New("fail")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := c.dispatchConcurrent(ctx, source, 3, func(ctx context.Context, event StreamEvent[any, string]) error {
+		if event.ID.Data == "05" {
+			return fail
+		}
+		offsets.handle(event.ID.Data)
+		return nil
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("dispatchConcurrent() error = %v, want %v", err, fail)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("dispatchConcurrent() returned on timeout, want stop on worker failure")
+	}
+	for _, offset := range offsets.offsets {
+		if offset >= "05" {
+			t.Errorf("offset %s committed past the failed event", offset)
+		}
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	w := &watermark{}
+	a := w.add(StreamOffset{ResumeToken: "a"})
+	b := w.add(StreamOffset{ResumeToken: "b"})
+	c := w.add(StreamOffset{ResumeToken: "c"})
+
+	w.done(b)
+	if _, _, ok := w.uncommitted(); ok {
+		t.Fatalf("uncommitted() returned an offset before the first event was handled")
+	}
+
+	w.done(a)
+	seq, offset, ok := w.uncommitted()
+	if !ok || seq != b || offset.ResumeToken != "b" {
+		t.Fatalf("uncommitted() = %d, %+v, %v, want offset b", seq, offset, ok)
+	}
+	w.commit(seq)
+	if _, _, ok := w.uncommitted(); ok {
+		t.Fatalf("uncommitted() returned an already committed offset")
+	}
+
+	w.done(c)
+	seq, offset, ok = w.uncommitted()
+	if !ok || seq != c || offset.ResumeToken != "c" {
+		t.Fatalf("uncommitted() = %d, %+v, %v, want offset c", seq, offset, ok)
+	}
+	w.commit(seq)
+	w.commit(a)
+	if w.committed != c {
+		t.Errorf("commit() moved the watermark backwards")
+	}
+}
+
+func TestKeyHash(t *testing.T) {
+	id := bson.NewObjectID()
+	if keyHash(id) != keyHash(id) {
+		t.Errorf("keyHash() is not stable")
+	}
+	if keyHash("1") == keyHash(int32(1)) && keyHash("2") == keyHash(int32(2)) {
+		t.Errorf("keyHash() ignores key type")
+	}
+	if keyHash(struct{ A int }{1}) != keyHash(struct{ A int }{1}) {
+		t.Errorf("keyHash() is not stable for documents")
+	}
+}
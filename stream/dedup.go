@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	mwerrors "github.com/YoungAgency/mongo-wrapper/v2/errors"
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DedupStore records the events already handled.
+type DedupStore interface {
+	// Claim marks key as handled, it returns false if key was already claimed within the retention window.
+	Claim(ctx context.Context, key string) (bool, error)
+	// Release removes a claim, so that the event can be handled again.
+	Release(ctx context.Context, key string) error
+}
+
+// Dedup calls the handler at most once per event key within the retention of store.
+// key returns the key of an event, if nil the resume token is used; events with an empty key are always handled.
+// The key is claimed before calling the handler and released if the handler fails, so that it can be retried.
+func Dedup[T any, K any](store DedupStore, key func(event StreamEvent[T, K]) string) Middleware[T, K] {
+	if key == nil {
+		key = func(event StreamEvent[T, K]) string {
+			return event.ID.Data
+		}
+	}
+	return func(next HandlerFn[T, K]) HandlerFn[T, K] {
+		return func(ctx context.Context, event StreamEvent[T, K]) error {
+			k := key(event)
+			if k == "" {
+				return next(ctx, event)
+			}
+			claimed, err := store.Claim(ctx, k)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return nil
+			}
+			if err := next(ctx, event); err != nil {
+				if releaseErr := store.Release(context.WithoutCancel(ctx), k); releaseErr != nil {
+					return errors.Join(err, releaseErr)
+				}
+				return err
+			}
+			return nil
+		}
+	}
+}
+
+// MemoryDedupStore is a DedupStore which keeps claims in memory, expired claims are removed while claiming.
+type MemoryDedupStore struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	claims map[string]time.Time
+	// expiries holds the claims in expiry order, since ttl is fixed it is a FIFO queue.
+	expiries []claimExpiry
+	now      func() time.Time
+}
+
+type claimExpiry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// NewMemoryDedupStore returns a MemoryDedupStore retaining claims for ttl.
+func NewMemoryDedupStore(ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		ttl:    ttl,
+		claims: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryDedupStore) Claim(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.evict(now)
+	if _, ok := s.claims[key]; ok {
+		return false, nil
+	}
+	expiresAt := now.Add(s.ttl)
+	s.claims[key] = expiresAt
+	s.expiries = append(s.expiries, claimExpiry{key: key, expiresAt: expiresAt})
+	return true, nil
+}
+
+// evict removes the claims expired at now from the head of the queue.
+func (s *MemoryDedupStore) evict(now time.Time) {
+	n := 0
+	for ; n < len(s.expiries) && !now.Before(s.expiries[n].expiresAt); n++ {
+		e := s.expiries[n]
+		// the key may have been released and claimed again
+		if expiresAt, ok := s.claims[e.key]; ok && expiresAt.Equal(e.expiresAt) {
+			delete(s.claims, e.key)
+		}
+	}
+	s.expiries = s.expiries[n:]
+}
+
+func (s *MemoryDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claims, key)
+	return nil
+}
+
+// DedupCollection is the subset of *mongo.Collection used by MongoDedupStore.
+type DedupCollection = OffsetCollection
+
+// MongoDedupStore is a DedupStore which keeps claims in a MongoDB collection, one document per key.
+// Expired claims can be reclaimed, create DedupTTLIndex on the collection to delete them.
+type MongoDedupStore struct {
+	collection DedupCollection
+	ttl        time.Duration
+}
+
+// NewMongoDedupStore returns a MongoDedupStore retaining claims for ttl.
+func NewMongoDedupStore(collection DedupCollection, ttl time.Duration) *MongoDedupStore {
+	return &MongoDedupStore{
+		collection: collection,
+		ttl:        ttl,
+	}
+}
+
+// DedupTTLIndex returns the TTL index which deletes expired claims of MongoDedupStore.
+func DedupTTLIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+}
+
+func (s *MongoDedupStore) Claim(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	filter := query.NewFilterBuilder().Eq("_id", key).Lt("expiresAt", now).Build()
+	update := query.NewUpdateBuilder().
+		Set("claimedAt", now).
+		Set("expiresAt", now.Add(s.ttl)).
+		Build()
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mwerrors.DuplicateKey(err) {
+		// claim exists and is not expired
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *MongoDedupStore) Release(ctx context.Context, key string) error {
+	filter := query.NewFilterBuilder().Eq("_id", key).Build()
+	_, err := s.collection.UpdateOne(ctx, filter, query.NewUpdateBuilder().Set("expiresAt", time.Time{}).Build())
+	return err
+}
@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	stores := []struct {
+		name  string
+		store DedupStore
+	}{
+		{name: "memory", store: NewMemoryDedupStore(time.Hour)},
+		{name: "mongo", store: NewMongoDedupStore(newMemoryCollection(), time.Hour)},
+	}
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fail := errors.New("fail")
+			calls := map[string]int{}
+			handler := Dedup[any, any](tt.store, nil)(func(ctx context.Context, event StreamEvent[any, any]) error {
+				calls[event.ID.Data]++
+				if event.OperationType == OperationDelete && calls[event.ID.Data] == 1 {
+					return fail
+				}
+				return nil
+			})
+			event := func(token, op string) StreamEvent[any, any] {
+				e := StreamEvent[any, any]{OperationType: op}
+				e.ID.Data = token
+				return e
+			}
+
+			steps := []struct {
+				event   StreamEvent[any, any]
+				wantErr error
+			}{
+				{event: event("1", OperationInsert)},
+				{event: event("1", OperationInsert)},
+				{event: event("2", OperationDelete), wantErr: fail},
+				{event: event("2", OperationDelete)},
+				{event: event("2", OperationDelete)},
+				{event: event("", OperationSnapshot)},
+				{event: event("", OperationSnapshot)},
+			}
+			for i, step := range steps {
+				if err := handler(ctx, step.event); !errors.Is(err, step.wantErr) {
+					t.Errorf("step %d: handler() error = %v, want %v", i, err, step.wantErr)
+				}
+			}
+			want := map[string]int{"1": 1, "2": 2, "": 2}
+			for token, n := range want {
+				if calls[token] != n {
+					t.Errorf("handler called %d times for %q, want %d", calls[token], token, n)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryDedupStore_expiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if ok, _ := s.Claim(ctx, "a"); !ok {
+		t.Fatalf("Claim() = false on new key")
+	}
+	if ok, _ := s.Claim(ctx, "a"); ok {
+		t.Errorf("Claim() = true on claimed key")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := s.Claim(ctx, "a"); !ok {
+		t.Errorf("Claim() = false on expired key")
+	}
+
+	// a released and claimed again key is not evicted by its previous claim
+	now = now.Add(30 * time.Second)
+	s.Claim(ctx, "b")
+	s.Release(ctx, "a")
+	s.Claim(ctx, "a")
+	now = now.Add(30 * time.Second)
+	if ok, _ := s.Claim(ctx, "a"); ok {
+		t.Errorf("Claim() = true on key claimed again")
+	}
+	if len(s.claims) != 2 || len(s.expiries) != 2 {
+		t.Errorf("claims = %d, queued = %d, want 2 and 2 after evicting the first claim", len(s.claims), len(s.expiries))
+	}
+}
+
+func TestMongoDedupStore_expiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMongoDedupStore(newMemoryCollection(), time.Millisecond)
+	if ok, err := s.Claim(ctx, "a"); !ok || err != nil {
+		t.Fatalf("Claim() = %v, %v on new key", ok, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, err := s.Claim(ctx, "a"); !ok || err != nil {
+		t.Errorf("Claim() = %v, %v on expired key", ok, err)
+	}
+}
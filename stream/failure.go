@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// FailurePolicy configures what a Consumer does when HandlerFn or OffsetManager.SetOffset fail.
+type FailurePolicy struct {
+	// MaxAttempts is the maximum number of attempts for a single event, 0 means retry forever.
+	MaxAttempts int
+	Backoff     Backoff
+	// Skip allows the consumer to advance the offset past an event whose attempts are exhausted.
+	// When false and no DeadLetter is configured, the consumer stops returning the handler error.
+	Skip bool
+	// DeadLetter, if set, receives events whose attempts are exhausted before the offset is advanced.
+	DeadLetter DeadLetterSink
+}
+
+// DeadLetter describes an event which could not be handled.
+type DeadLetter struct {
+	// Event is the raw change event.
+	Event bson.Raw
+	// StreamEvent is the decoded event, a StreamEvent[T, K] with the types of the consumer,
+	// e.g. letter.StreamEvent.(StreamEvent[User, bson.ObjectID]).
+	StreamEvent   any
+	OperationType string
+	Offset        StreamOffset
+	Attempts      int
+	Err           error
+}
+
+// DeadLetterSink stores events which could not be handled.
+// If Send returns an error, the consumer stops without advancing the offset.
+type DeadLetterSink interface {
+	Send(ctx context.Context, letter DeadLetter) error
+}
+
+// defaultFailurePolicy retries forever every second.
+var defaultFailurePolicy = FailurePolicy{
+	Backoff: Backoff{Initial: time.Second, Max: time.Second},
+}
+
+// retry calls fn until it succeeds, attempts are exhausted or ctx is done.
+// It returns the number of attempts and the last error.
+func (p FailurePolicy) retry(ctx context.Context, fn func(ctx context.Context) error) (int, error) {
+	attempt := 0
+	for {
+		attempt++
+		err := fn(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+		if ctx.Err() != nil {
+			return attempt, ctx.Err()
+		}
+		if errors.Is(err, ErrLeaseLost) {
+			// retrying cannot succeed until the lease is acquired again
+			return attempt, err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return attempt, err
+		}
+		if err := sleepContext(ctx, p.Backoff.Duration(attempt)); err != nil {
+			return attempt, err
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	letters []DeadLetter
+	err     error
+}
+
+func (s *recordingSink) Send(ctx context.Context, letter DeadLetter) error {
+	s.letters = append(s.letters, letter)
+	return s.err
+}
+
+type countingOffsetManager struct {
+	defaultOffsetManager
+	failures int
+	offsets  []StreamOffset
+}
+
+func (m *countingOffsetManager) SetOffset(ctx context.Context, offset StreamOffset) error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("unavailable")
+	}
+	m.offsets = append(m.offsets, offset)
+	return nil
+}
+
+func TestFailurePolicy_retry(t *testing.T) {
+	p := FailurePolicy{MaxAttempts: 3, Backoff: Backoff{Initial: time.Millisecond, Max: time.Millisecond}}
+	fail := errors.New("fail")
+
+	calls := 0
+	attempts, err := p.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return fail
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("retry() = %d, %v, want 2, nil", attempts, err)
+	}
+
+	attempts, err = p.retry(context.Background(), func(ctx context.Context) error {
+		return fail
+	})
+	if !errors.Is(err, fail) || attempts != 3 {
+		t.Errorf("retry() = %d, %v, want 3, %v", attempts, err, fail)
+	}
+}
+
+func TestFailurePolicy_retryInterruptedByContext(t *testing.T) {
+	p := FailurePolicy{Backoff: Backoff{Initial: time.Hour, Max: time.Hour}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.retry(ctx, func(ctx context.Context) error {
+		return errors.New("fail")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("retry() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("retry() did not stop on context cancellation")
+	}
+}
+
+func TestConsumer_handleEvent(t *testing.T) {
+	fail := errors.New("fail")
+	failing := func(ctx context.Context, event StreamEvent[any, any]) error { return fail }
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	tests := []struct {
+		name        string
+		policy      FailurePolicy
+		sink        *recordingSink
+		wantErr     error
+		wantLetters int
+		wantOffsets int
+	}{
+		{
+			name:        "exhausted attempts stop the consumer",
+			policy:      FailurePolicy{MaxAttempts: 2, Backoff: backoff},
+			wantErr:     fail,
+			wantOffsets: 0,
+		},
+		{
+			name:        "exhausted attempts are skipped",
+			policy:      FailurePolicy{MaxAttempts: 2, Backoff: backoff, Skip: true},
+			wantOffsets: 1,
+		},
+		{
+			name:        "exhausted attempts are dead lettered",
+			policy:      FailurePolicy{MaxAttempts: 2, Backoff: backoff},
+			sink:        &recordingSink{},
+			wantLetters: 1,
+			wantOffsets: 1,
+		},
+		{
+			name:        "dead letter failure stops the consumer",
+			policy:      FailurePolicy{MaxAttempts: 1, Backoff: backoff},
+			sink:        &recordingSink{err: fail},
+			wantErr:     fail,
+			wantLetters: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sink != nil {
+				tt.policy.DeadLetter = tt.sink
+			}
+			om := &countingOffsetManager{}
+			c := &Consumer[any, any]{tokenManager: om, failure: tt.policy}
+			event := StreamEvent[any, any]{OperationType: "insert"}
+			event.ID.Data = "token"
+
+			err := c.handleEvent(context.Background(), nil, event, failing)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("handleEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(om.offsets) != tt.wantOffsets {
+				t.Errorf("handleEvent() committed %d offsets, want %d", len(om.offsets), tt.wantOffsets)
+			}
+			if tt.sink != nil {
+				if len(tt.sink.letters) != tt.wantLetters {
+					t.Fatalf("handleEvent() sent %d dead letters, want %d", len(tt.sink.letters), tt.wantLetters)
+				}
+				letter := tt.sink.letters[0]
+				if letter.Offset.ResumeToken != "token" || letter.Attempts != tt.policy.MaxAttempts || !errors.Is(letter.Err, fail) {
+					t.Errorf("handleEvent() unexpected dead letter %+v", letter)
+				}
+				if decoded, ok := letter.StreamEvent.(StreamEvent[any, any]); !ok || decoded.ID.Data != "token" {
+					t.Errorf("dead letter StreamEvent = %+v, want the decoded event", letter.StreamEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumer_commitOffset(t *testing.T) {
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	om := &countingOffsetManager{failures: 2}
+	c := &Consumer[any, any]{tokenManager: om, failure: FailurePolicy{MaxAttempts: 3, Backoff: backoff}}
+	if err := c.commitOffset(context.Background(), StreamOffset{ResumeToken: "a"}); err != nil {
+		t.Errorf("commitOffset() error = %v", err)
+	}
+	if len(om.offsets) != 1 {
+		t.Errorf("commitOffset() committed %d offsets, want 1", len(om.offsets))
+	}
+
+	om = &countingOffsetManager{failures: 5}
+	c = &Consumer[any, any]{tokenManager: om, failure: FailurePolicy{MaxAttempts: 2, Backoff: backoff}}
+	if err := c.commitOffset(context.Background(), StreamOffset{ResumeToken: "a"}); err == nil {
+		t.Errorf("commitOffset() expected error")
+	}
+
+	c.failure.Skip = true
+	if err := c.commitOffset(context.Background(), StreamOffset{ResumeToken: "a"}); err != nil {
+		t.Errorf("commitOffset() with skip error = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileOffsetManager stores the offset as JSON in a local file.
+// Writes are atomic: offset is written to a temporary file which is synced and renamed over the previous one.
+type FileOffsetManager struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileOffsetManager returns a FileOffsetManager which stores the offset in path.
+// Directory of path must exist.
+func NewFileOffsetManager(path string) *FileOffsetManager {
+	return &FileOffsetManager{
+		path: path,
+	}
+}
+
+func (f *FileOffsetManager) GetOffset(ctx context.Context) (*StreamOffset, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	offset := &StreamOffset{}
+	if err := json.Unmarshal(b, offset); err != nil {
+		return nil, err
+	}
+	return offset, nil
+}
+
+func (f *FileOffsetManager) SetOffset(ctx context.Context, offset StreamOffset) error {
+	b, err := json.Marshal(offset)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes directory entries, so that a rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
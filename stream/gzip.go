@@ -3,17 +3,37 @@ package stream
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
+	"sync"
 )
 
+// gzipWriters holds a pool of writers for each compression level, from gzip.HuffmanOnly to gzip.BestCompression.
+var gzipWriters [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+var gzipReaders sync.Pool
+
+// GzipEncoderDecoder encodes events with gzip, the zero value uses gzip.DefaultCompression.
+// Writers and readers are pooled, so it is safe and cheap to use concurrently.
 type GzipEncoderDecoder struct {
+	level int
+	set   bool
+}
+
+// NewGzipEncoderDecoder returns a GzipEncoderDecoder compressing with level, one of the compress/gzip levels.
+func NewGzipEncoderDecoder(level int) (*GzipEncoderDecoder, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("gzip: invalid compression level: %d", level)
+	}
+	return &GzipEncoderDecoder{level: level, set: true}, nil
 }
 
 func (d *GzipEncoderDecoder) Encode(raw []byte) ([]byte, error) {
 	var b bytes.Buffer
-	writer := gzip.NewWriter(&b)
+	writer := d.EncodeTo(&b)
 	_, err := writer.Write(raw)
 	if err != nil {
+		writer.Close()
 		return nil, err
 	}
 	err = writer.Close()
@@ -24,7 +44,7 @@ func (d *GzipEncoderDecoder) Encode(raw []byte) ([]byte, error) {
 }
 
 func (d *GzipEncoderDecoder) Decode(raw []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(raw))
+	reader, err := d.DecodeFrom(bytes.NewReader(raw))
 	if err != nil {
 		return nil, err
 	}
@@ -36,3 +56,69 @@ func (d *GzipEncoderDecoder) Decode(raw []byte) ([]byte, error) {
 	}
 	return b, nil
 }
+
+// EncodeTo returns a writer which compresses to w, it must be closed to flush the compressed data.
+// Close does not close w.
+func (d *GzipEncoderDecoder) EncodeTo(w io.Writer) io.WriteCloser {
+	level := gzip.DefaultCompression
+	if d.set {
+		level = d.level
+	}
+	pool := &gzipWriters[level-gzip.HuffmanOnly]
+	writer, _ := pool.Get().(*gzip.Writer)
+	if writer == nil {
+		// level is validated by NewGzipEncoderDecoder
+		writer, _ = gzip.NewWriterLevel(w, level)
+	} else {
+		writer.Reset(w)
+	}
+	return &pooledGzipWriter{Writer: writer, pool: pool}
+}
+
+// DecodeFrom returns a reader which decompresses r, it must be closed to release its resources.
+// Close does not close r.
+func (d *GzipEncoderDecoder) DecodeFrom(r io.Reader) (io.ReadCloser, error) {
+	reader, _ := gzipReaders.Get().(*gzip.Reader)
+	var err error
+	if reader == nil {
+		reader, err = gzip.NewReader(r)
+	} else {
+		err = reader.Reset(r)
+	}
+	if err != nil {
+		if reader != nil {
+			gzipReaders.Put(reader)
+		}
+		return nil, err
+	}
+	return &pooledGzipReader{Reader: reader}, nil
+}
+
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+type pooledGzipReader struct {
+	*gzip.Reader
+}
+
+func (r *pooledGzipReader) Close() error {
+	if r.Reader == nil {
+		return nil
+	}
+	err := r.Reader.Close()
+	gzipReaders.Put(r.Reader)
+	r.Reader = nil
+	return err
+}
@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewGzipEncoderDecoder(t *testing.T) {
+	raw := bytes.Repeat([]byte("stream event "), 100)
+	for _, level := range []int{gzip.HuffmanOnly, gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression} {
+		d, err := NewGzipEncoderDecoder(level)
+		if err != nil {
+			t.Fatalf("NewGzipEncoderDecoder(%d) error = %v", level, err)
+		}
+		encoded, err := d.Encode(raw)
+		if err != nil {
+			t.Fatalf("Encode() level %d error = %v", level, err)
+		}
+		decoded, err := (&GzipEncoderDecoder{}).Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, raw) {
+			t.Errorf("Decode() level %d = %q, %v", level, decoded, err)
+		}
+	}
+	if _, err := NewGzipEncoderDecoder(10); err == nil {
+		t.Errorf("NewGzipEncoderDecoder(10) expected error")
+	}
+}
+
+func TestGzipEncoderDecoder_streaming(t *testing.T) {
+	d := &GzipEncoderDecoder{}
+	var compressed bytes.Buffer
+	sink := NewWriterSink(d.EncodeTo(&compressed))
+	for i := 0; i < 3; i++ {
+		if err := sink.Write(context.Background(), Message{Value: []byte(`{"n":1}`)}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	// writes are flushed, so that acknowledged messages can be read before closing
+	if err := sink.w.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := sink.w.(io.Closer).Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+
+	reader, err := d.DecodeFrom(&compressed)
+	if err != nil {
+		t.Fatalf("DecodeFrom() error = %v", err)
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	lines := 0
+	for scanner.Scan() {
+		if scanner.Text() != `{"n":1}` {
+			t.Errorf("line = %q", scanner.Text())
+		}
+		lines++
+	}
+	if err := scanner.Err(); err != nil || lines != 3 {
+		t.Errorf("read %d lines, %v, want 3", lines, err)
+	}
+
+	if _, err := d.DecodeFrom(strings.NewReader("not gzip")); err == nil {
+		t.Errorf("DecodeFrom() expected error on invalid data")
+	}
+}
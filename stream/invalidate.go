@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// InvalidateMode selects what a consumer does when its change stream is invalidated.
+type InvalidateMode int
+
+const (
+	// InvalidateStop stops the consumer returning an *InvalidatedError.
+	InvalidateStop InvalidateMode = iota
+	// InvalidateRestart reopens the stream with startAfter on the invalidate event token.
+	InvalidateRestart
+)
+
+// InvalidatedError is returned when the change stream is invalidated, e.g. because
+// the watched collection was dropped or renamed.
+type InvalidatedError struct {
+	// Cause is the operation type which invalidated the stream: drop, rename or dropDatabase,
+	// it is empty if the event was not seen by the consumer.
+	Cause     string
+	Namespace Namespace
+	// To is the new namespace of a renamed collection.
+	To *Namespace
+	// Offset is the offset of the invalidate event.
+	Offset StreamOffset
+}
+
+func (e *InvalidatedError) Error() string {
+	if e.Cause == "" {
+		return fmt.Sprintf("change stream on %s.%s invalidated", e.Namespace.DB, e.Namespace.Coll)
+	}
+	return fmt.Sprintf("change stream on %s.%s invalidated by %s", e.Namespace.DB, e.Namespace.Coll, e.Cause)
+}
+
+// invalidation tracks the events which lead to an invalidate event.
+type invalidation struct {
+	cause       string
+	ns          Namespace
+	to          *Namespace
+	invalidated *StreamOffset
+}
+
+// observe records an event read from the stream.
+func (i *invalidation) observe(operationType string, ns Namespace, to *Namespace, offset *StreamOffset) {
+	switch operationType {
+	case OperationDrop, OperationRename, OperationDropDatabase:
+		i.cause, i.ns, i.to = operationType, ns, to
+	case OperationInvalidate:
+		i.invalidated = offset
+		if i.cause == "" {
+			i.ns = ns
+		}
+	}
+}
+
+// invalidated returns an *InvalidatedError if an invalidate event was observed, notifying Config.OnInvalidate.
+func (c *Consumer[T, K]) invalidated(ctx context.Context, i *invalidation) error {
+	if i.invalidated == nil {
+		return nil
+	}
+	err := &InvalidatedError{
+		Cause:     i.cause,
+		Namespace: i.ns,
+		To:        i.to,
+		Offset:    *i.invalidated,
+	}
+	if c.onInvalidate != nil {
+		c.onInvalidate(ctx, err)
+	}
+	return err
+}
+
+// run calls fn applying the lease, the reconnect policy and the invalidate mode.
+func (c *Consumer[T, K]) run(ctx context.Context, fn streamRun) error {
+	if c.lease != nil {
+		return c.lease.Run(ctx, func(ctx context.Context) error {
+			return c.runStream(ctx, fn)
+		})
+	}
+	return c.runStream(ctx, fn)
+}
+
+// runStream calls fn applying the reconnect policy and the invalidate mode.
+func (c *Consumer[T, K]) runStream(ctx context.Context, fn streamRun) error {
+	start := &streamStart{}
+	for {
+		var err error
+		if c.reconnect == nil {
+			_, err = fn(ctx, start)
+		} else {
+			err = c.supervise(ctx, start, fn)
+		}
+		var invalidated *InvalidatedError
+		if c.invalidateMode == InvalidateRestart && errors.As(err, &invalidated) && ctx.Err() == nil {
+			start = &streamStart{after: invalidated.Offset.ResumeToken}
+			continue
+		}
+		return err
+	}
+}
+
+// streamStart is where the streams of a run start from.
+type streamStart struct {
+	// after is the resume token of the invalidate event a restarted stream starts after,
+	// it is cleared once the stream is opened so that reconnects resume from the stored offset.
+	after string
+}
+
+// startOffset returns the offset a stream starts from: the invalidate event if the stream is restarted,
+// otherwise the stored offset. restarted reports whether the offset is the invalidate event.
+func (c *Consumer[T, K]) startOffset(ctx context.Context, start *streamStart) (offset *StreamOffset, restarted bool, err error) {
+	if start != nil && start.after != "" {
+		return &StreamOffset{ResumeToken: start.after}, true, nil
+	}
+	offset, err = c.tokenManager.GetOffset(ctx)
+	return offset, false, err
+}
+
+// opened clears the restart token once the stream is opened.
+func (s *streamStart) opened() {
+	if s != nil {
+		s.after = ""
+	}
+}
@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInvalidation(t *testing.T) {
+	ns := Namespace{DB: "app", Coll: "users"}
+	to := &Namespace{DB: "app", Coll: "users_v2"}
+
+	var notified *InvalidatedError
+	c := &Consumer[any, any]{onInvalidate: func(ctx context.Context, err *InvalidatedError) {
+		notified = err
+	}}
+
+	inv := &invalidation{}
+	inv.observe(OperationInsert, ns, nil, &StreamOffset{ResumeToken: "1"})
+	if err := c.invalidated(context.Background(), inv); err != nil {
+		t.Fatalf("invalidated() = %v before an invalidate event", err)
+	}
+
+	inv.observe(OperationRename, ns, to, &StreamOffset{ResumeToken: "2"})
+	inv.observe(OperationInvalidate, ns, nil, &StreamOffset{ResumeToken: "3"})
+	err := c.invalidated(context.Background(), inv)
+	var invalidated *InvalidatedError
+	if !errors.As(err, &invalidated) {
+		t.Fatalf("invalidated() = %v, want *InvalidatedError", err)
+	}
+	if invalidated.Cause != OperationRename || invalidated.Namespace != ns || invalidated.To != to || invalidated.Offset.ResumeToken != "3" {
+		t.Errorf("invalidated() = %+v", invalidated)
+	}
+	if notified != invalidated {
+		t.Errorf("OnInvalidate was not notified")
+	}
+	if invalidated.Error() != "change stream on app.users invalidated by rename" {
+		t.Errorf("Error() = %q", invalidated.Error())
+	}
+}
+
+func TestConsumer_runInvalidateMode(t *testing.T) {
+	invalidated := &InvalidatedError{Cause: OperationDrop}
+	fatal := errors.New("fatal")
+
+	tests := []struct {
+		name      string
+		mode      InvalidateMode
+		results   []error
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "stop mode returns the invalidated error",
+			mode:      InvalidateStop,
+			results:   []error{invalidated},
+			wantErr:   invalidated,
+			wantCalls: 1,
+		},
+		{
+			name:      "restart mode reopens the stream",
+			mode:      InvalidateRestart,
+			results:   []error{invalidated, invalidated, fatal},
+			wantErr:   fatal,
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Consumer[any, any]{invalidateMode: tt.mode}
+			calls := 0
+			err := c.run(context.Background(), func(ctx context.Context, start *streamStart) (bool, error) {
+				err := tt.results[calls]
+				calls++
+				return false, err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("run() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("run() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestConsumer_runInvalidateRestart_startAfter(t *testing.T) {
+	c := &Consumer[any, any]{invalidateMode: InvalidateRestart, tokenManager: &defaultOffsetManager{}}
+	fatal := errors.New("fatal")
+
+	var starts []*StreamOffset
+	err := c.run(context.Background(), func(ctx context.Context, start *streamStart) (bool, error) {
+		offset, restarted, err := c.startOffset(ctx, start)
+		if err != nil {
+			return false, err
+		}
+		starts = append(starts, offset)
+		if len(starts) == 1 {
+			return false, &InvalidatedError{Cause: OperationDrop, Offset: StreamOffset{ResumeToken: "3"}}
+		}
+		if !restarted {
+			t.Errorf("startOffset() restarted = false on the restarted stream")
+		}
+		start.opened()
+		if offset, restarted, _ := c.startOffset(ctx, start); offset != nil || restarted {
+			t.Errorf("startOffset() = %+v, %v once the stream is opened, want stored offset", offset, restarted)
+		}
+		return false, fatal
+	})
+	if !errors.Is(err, fatal) {
+		t.Fatalf("run() error = %v, want %v", err, fatal)
+	}
+	if len(starts) != 2 || starts[0] != nil || starts[1] == nil || starts[1].ResumeToken != "3" {
+		t.Errorf("start offsets = %+v, want stored offset then the invalidate token", starts)
+	}
+}
@@ -0,0 +1,234 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	mwerrors "github.com/YoungAgency/mongo-wrapper/v2/errors"
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrLeaseLost is returned when an operation requires a lease which is no longer held,
+// or whose fencing token is older than the one stored.
+var ErrLeaseLost = errors.New("lease lost")
+
+// LeaseCollection is the subset of *mongo.Collection used by Lease.
+type LeaseCollection = OffsetCollection
+
+// LeaseConfig configures a Lease.
+type LeaseConfig struct {
+	// Name identifies the lease, replicas competing for the same stream must use the same name.
+	Name string
+	// Owner identifies the replica, e.g. the hostname, it must be unique among replicas.
+	Owner string
+	// TTL is the validity of the lease after each renewal, default 15s.
+	TTL time.Duration
+	// RenewInterval is how often the lease is renewed, or its acquisition retried, default TTL/3.
+	RenewInterval time.Duration
+	// OnStepDown, if set, is called when the lease is lost while running.
+	OnStepDown func(ctx context.Context)
+}
+
+// Lease is a leader election lease stored in a MongoDB collection, one document per lease name.
+// Each acquisition increments a fencing token, so that writes of a previous holder can be rejected.
+type Lease struct {
+	collection    LeaseCollection
+	name          string
+	owner         string
+	ttl           time.Duration
+	renewInterval time.Duration
+	onStepDown    func(ctx context.Context)
+
+	mu    sync.Mutex
+	token int64
+	held  bool
+}
+
+// leaseDocument is the document stored by Lease.
+type leaseDocument struct {
+	Name      string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	Token     int64     `bson:"token"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+func NewLease(collection LeaseCollection, conf LeaseConfig) *Lease {
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	renewInterval := conf.RenewInterval
+	if renewInterval <= 0 {
+		renewInterval = ttl / 3
+	}
+	return &Lease{
+		collection:    collection,
+		name:          conf.Name,
+		owner:         conf.Owner,
+		ttl:           ttl,
+		renewInterval: renewInterval,
+		onStepDown:    conf.OnStepDown,
+	}
+}
+
+// FencingToken returns the token of the lease, false if it is not held.
+func (l *Lease) FencingToken() (int64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token, l.held
+}
+
+// TryAcquire acquires the lease if it is free or expired, it returns false if another owner holds it.
+func (l *Lease) TryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	filter := query.NewFilterBuilder().Eq("_id", l.name).Lt("expiresAt", now).Build()
+	update := query.NewUpdateBuilder().
+		Set("owner", l.owner).
+		Set("expiresAt", now.Add(l.ttl)).
+		Inc("token", int64(1)).
+		Build()
+	_, err := l.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mwerrors.DuplicateKey(err) {
+		// lease exists and is not expired
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var doc leaseDocument
+	filter = query.NewFilterBuilder().Eq("_id", l.name).Eq("owner", l.owner).Build()
+	if err := l.collection.FindOne(ctx, filter).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+	l.mu.Lock()
+	l.token, l.held = doc.Token, true
+	l.mu.Unlock()
+	return true, nil
+}
+
+// Renew extends the lease, it returns ErrLeaseLost if the lease is no longer held.
+func (l *Lease) Renew(ctx context.Context) error {
+	token, held := l.FencingToken()
+	if !held {
+		return ErrLeaseLost
+	}
+	res, err := l.collection.UpdateOne(ctx, l.ownFilter(token), query.NewUpdateBuilder().Set("expiresAt", time.Now().Add(l.ttl)).Build())
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		l.lost(token)
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Release gives the lease up, so that another owner can acquire it without waiting for it to expire.
+func (l *Lease) Release(ctx context.Context) error {
+	token, held := l.FencingToken()
+	if !held {
+		return nil
+	}
+	l.lost(token)
+	_, err := l.collection.UpdateOne(ctx, l.ownFilter(token), query.NewUpdateBuilder().Set("expiresAt", time.Time{}).Build())
+	return err
+}
+
+// Run waits until the lease is acquired and calls fn with a context cancelled as soon as the lease is lost.
+// If the lease is lost, or fn returns ErrLeaseLost, fn is called again once the lease is acquired again,
+// otherwise its error is returned and the lease released.
+func (l *Lease) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	for {
+		if err := l.acquire(ctx); err != nil {
+			return err
+		}
+		token, _ := l.FencingToken()
+		leaderCtx, cancel := context.WithCancel(ctx)
+		renewed := make(chan struct{})
+		go func() {
+			defer close(renewed)
+			defer cancel()
+			l.keepAlive(leaderCtx)
+		}()
+		err := fn(leaderCtx)
+		cancel()
+		<-renewed
+
+		if errors.Is(err, ErrLeaseLost) {
+			// a fenced write found a newer holder before keepAlive did
+			l.lost(token)
+		}
+		if _, held := l.FencingToken(); !held && ctx.Err() == nil {
+			if l.onStepDown != nil {
+				l.onStepDown(ctx)
+			}
+			continue
+		}
+		if releaseErr := l.Release(context.WithoutCancel(ctx)); err == nil {
+			err = releaseErr
+		}
+		return err
+	}
+}
+
+// acquire retries TryAcquire every renew interval until it succeeds.
+func (l *Lease) acquire(ctx context.Context) error {
+	for {
+		acquired, err := l.TryAcquire(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if acquired {
+			return nil
+		}
+		if err := sleepContext(ctx, l.renewInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// keepAlive renews the lease until ctx is done. It returns when the lease is lost,
+// or when it could not be renewed before expiring.
+func (l *Lease) keepAlive(ctx context.Context) {
+	expiresAt := time.Now().Add(l.ttl)
+	for {
+		if err := sleepContext(ctx, l.renewInterval); err != nil {
+			return
+		}
+		err := l.Renew(ctx)
+		switch {
+		case err == nil:
+			expiresAt = time.Now().Add(l.ttl)
+		case errors.Is(err, ErrLeaseLost):
+			return
+		case ctx.Err() != nil:
+			return
+		case !time.Now().Add(l.renewInterval).Before(expiresAt):
+			// lease would expire before the next attempt
+			token, _ := l.FencingToken()
+			l.lost(token)
+			return
+		}
+	}
+}
+
+func (l *Lease) ownFilter(token int64) any {
+	return query.NewFilterBuilder().Eq("_id", l.name).Eq("owner", l.owner).Eq("token", token).Build()
+}
+
+// lost marks the lease acquired with token as no longer held.
+func (l *Lease) lost(token int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token == token {
+		l.held = false
+	}
+}
@@ -0,0 +1,183 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	a := NewLease(coll, LeaseConfig{Name: "orders", Owner: "a", TTL: time.Hour})
+	b := NewLease(coll, LeaseConfig{Name: "orders", Owner: "b", TTL: time.Hour})
+
+	if ok, err := a.TryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("a.TryAcquire() = %v, %v, want true", ok, err)
+	}
+	if token, held := a.FencingToken(); token != 1 || !held {
+		t.Errorf("a.FencingToken() = %d, %v, want 1, true", token, held)
+	}
+	if ok, err := b.TryAcquire(ctx); ok || err != nil {
+		t.Fatalf("b.TryAcquire() = %v, %v, want false while a holds the lease", ok, err)
+	}
+	if err := a.Renew(ctx); err != nil {
+		t.Errorf("a.Renew() error = %v", err)
+	}
+
+	if err := a.Release(ctx); err != nil {
+		t.Fatalf("a.Release() error = %v", err)
+	}
+	if ok, err := b.TryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("b.TryAcquire() = %v, %v, want true after release", ok, err)
+	}
+	if token, _ := b.FencingToken(); token != 2 {
+		t.Errorf("b.FencingToken() = %d, want 2", token)
+	}
+	if _, held := a.FencingToken(); held {
+		t.Errorf("a.FencingToken() held after release")
+	}
+}
+
+func TestLease_expired(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	a := NewLease(coll, LeaseConfig{Name: "orders", Owner: "a", TTL: time.Millisecond})
+	b := NewLease(coll, LeaseConfig{Name: "orders", Owner: "b", TTL: time.Hour})
+
+	if ok, _ := a.TryAcquire(ctx); !ok {
+		t.Fatalf("a.TryAcquire() = false")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, err := b.TryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("b.TryAcquire() = %v, %v, want true on expired lease", ok, err)
+	}
+	if err := a.Renew(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("a.Renew() error = %v, want %v", err, ErrLeaseLost)
+	}
+}
+
+func TestLease_Run(t *testing.T) {
+	coll := newMemoryCollection()
+	stepDown := make(chan struct{}, 1)
+	lease := NewLease(coll, LeaseConfig{
+		Name:          "orders",
+		Owner:         "a",
+		TTL:           time.Hour,
+		RenewInterval: time.Millisecond,
+		OnStepDown: func(ctx context.Context) {
+			stepDown <- struct{}{}
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- lease.Run(ctx, func(ctx context.Context) error {
+			runs++
+			if runs == 1 {
+				// another owner takes the lease over
+				coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: "orders"}}, bson.D{{Key: "$set", Value: bson.D{
+					{Key: "owner", Value: "b"},
+					{Key: "token", Value: int64(2)},
+					{Key: "expiresAt", Value: time.Now()},
+				}}})
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	select {
+	case <-stepDown:
+	case <-time.After(time.Second):
+		t.Fatalf("OnStepDown was not called after losing the lease")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if runs != 2 {
+		t.Errorf("fn called %d times, want 2, lease must be acquired again once expired", runs)
+	}
+}
+
+func TestMongoOffsetManager_lease(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	leases := newMemoryCollection()
+	a := NewLease(leases, LeaseConfig{Name: "orders", Owner: "a", TTL: time.Hour})
+	b := NewLease(leases, LeaseConfig{Name: "orders", Owner: "b", TTL: time.Hour})
+	ma := NewMongoOffsetManager(coll, "orders", true).WithLease(a)
+	mb := NewMongoOffsetManager(coll, "orders", true).WithLease(b)
+
+	if err := ma.SetOffset(ctx, StreamOffset{ResumeToken: "1"}); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("SetOffset() error = %v, want %v before acquiring", err, ErrLeaseLost)
+	}
+	a.TryAcquire(ctx)
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	if err := ma.SetOffset(ctx, StreamOffset{ResumeToken: "1", Timestamp: ts}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+
+	a.Release(ctx)
+	b.TryAcquire(ctx)
+	if err := mb.SetOffset(ctx, StreamOffset{ResumeToken: "2", Timestamp: ts.Add(time.Second)}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	// a still believes to hold the lease with an older fencing token
+	a.mu.Lock()
+	a.held = true
+	a.mu.Unlock()
+	if err := ma.SetOffset(ctx, StreamOffset{ResumeToken: "3", Timestamp: ts.Add(2 * time.Second)}); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("SetOffset() error = %v, want %v with an older fencing token", err, ErrLeaseLost)
+	}
+	got, _ := mb.GetOffset(ctx)
+	if got.ResumeToken != "2" {
+		t.Errorf("GetOffset() = %+v, want offset 2", got)
+	}
+}
+
+func TestLease_Run_fencedWrite(t *testing.T) {
+	coll := newMemoryCollection()
+	stepDowns := 0
+	lease := NewLease(coll, LeaseConfig{
+		Name:          "orders",
+		Owner:         "a",
+		TTL:           time.Hour,
+		RenewInterval: time.Hour,
+		OnStepDown: func(ctx context.Context) {
+			stepDowns++
+		},
+	})
+
+	runs := 0
+	err := lease.Run(context.Background(), func(ctx context.Context) error {
+		runs++
+		if runs == 1 {
+			// another owner took the lease over before keepAlive noticed
+			coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: "orders"}}, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "owner", Value: "b"},
+				{Key: "token", Value: int64(2)},
+				{Key: "expiresAt", Value: time.Now().Add(-time.Second)},
+			}}})
+			return fmt.Errorf("commit: %w", ErrLeaseLost)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if runs != 2 || stepDowns != 1 {
+		t.Errorf("fn called %d times with %d step downs, want 2 and 1", runs, stepDowns)
+	}
+	if token, _ := lease.FencingToken(); token != 3 {
+		t.Errorf("FencingToken() = %d, want 3 after acquiring again", token)
+	}
+}
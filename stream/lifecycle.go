@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrConsumerRunning    = errors.New("consumer is already running")
+	ErrConsumerNotRunning = errors.New("consumer is not running")
+)
+
+// StopReason tells why a consumer stopped.
+type StopReason string
+
+const (
+	// StopReasonShutdown is returned when the consumer was stopped by its context or by Stop.
+	StopReasonShutdown StopReason = "shutdown"
+	// StopReasonStreamClosed is returned when the change stream ended without errors.
+	StopReasonStreamClosed StopReason = "stream_closed"
+	// StopReasonInvalidated is returned when the change stream was invalidated, Err is an *InvalidatedError.
+	StopReasonInvalidated StopReason = "invalidated"
+	// StopReasonError is returned when the consumer stopped because of an error.
+	StopReasonError StopReason = "error"
+)
+
+// StopStatus describes how a consumer stopped.
+type StopStatus struct {
+	Reason StopReason
+	// Err is the error which stopped the consumer, set only when Reason is StopReasonError or StopReasonInvalidated.
+	Err error
+	// Offset is the last offset committed through OffsetManager, nil if none was committed.
+	Offset *StreamOffset
+	// Drained is false if the in-flight handler was cancelled because DrainTimeout expired.
+	Drained bool
+}
+
+type runState struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	status StopStatus
+}
+
+// Run handles events like ConsumeHandler until ctx is done, the stream ends or an error occurs.
+// When ctx is done no more events are read, the in-flight handler is given Config.DrainTimeout
+// to complete and its offset is committed before the stream is closed.
+func (c *Consumer[T, K]) Run(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) StopStatus {
+	return c.runDraining(ctx, func(ctx, streamCtx context.Context, start *streamStart) (bool, error) {
+		return c.consumeHandler(ctx, streamCtx, start, streamOptions, handler)
+	})
+}
+
+// runDraining calls consume until ctx is done, reading events with streamCtx, cancelled as soon as ctx is done,
+// and handling them with a context cancelled only once the drain timeout expires.
+func (c *Consumer[T, K]) runDraining(ctx context.Context, consume func(ctx, streamCtx context.Context, start *streamStart) (bool, error)) StopStatus {
+	work, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	streamCtx, stop := context.WithCancel(work)
+	defer stop()
+
+	var interrupted atomic.Bool
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-work.Done():
+			return
+		}
+		t := time.NewTimer(c.drainTimeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			interrupted.Store(true)
+			cancelWork()
+		case <-work.Done():
+		}
+	}()
+
+	run := func(streamCtx context.Context, start *streamStart) (bool, error) {
+		return consume(work, streamCtx, start)
+	}
+	err := c.run(streamCtx, run)
+
+	status := StopStatus{
+		Offset:  c.lastCommitted(),
+		Drained: !interrupted.Load(),
+	}
+	var invalidated *InvalidatedError
+	switch {
+	case ctx.Err() != nil:
+		status.Reason = StopReasonShutdown
+	case errors.As(err, &invalidated):
+		status.Reason, status.Err = StopReasonInvalidated, err
+	case err != nil:
+		status.Reason, status.Err = StopReasonError, err
+	default:
+		status.Reason = StopReasonStreamClosed
+	}
+	return status
+}
+
+// Start calls Run in background, use Stop to shut the consumer down and get its StopStatus.
+func (c *Consumer[T, K]) Start(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running != nil {
+		return ErrConsumerRunning
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	state := &runState{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.running = state
+	go func() {
+		defer close(state.done)
+		defer cancel()
+		state.status = c.Run(ctx, streamOptions, handler)
+	}()
+	return nil
+}
+
+// Stop shuts down a consumer started with Start and waits until it is stopped or ctx is done.
+// If the consumer already stopped on its own, its StopStatus is returned.
+func (c *Consumer[T, K]) Stop(ctx context.Context) (StopStatus, error) {
+	c.mu.Lock()
+	state := c.running
+	c.mu.Unlock()
+	if state == nil {
+		return StopStatus{}, ErrConsumerNotRunning
+	}
+	state.cancel()
+	select {
+	case <-state.done:
+	case <-ctx.Done():
+		return StopStatus{}, ctx.Err()
+	}
+	c.mu.Lock()
+	if c.running == state {
+		c.running = nil
+	}
+	c.mu.Unlock()
+	return state.status, nil
+}
+
+// lastCommitted returns the last offset committed by the consumer.
+func (c *Consumer[T, K]) lastCommitted() *StreamOffset {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.committed == nil {
+		return nil
+	}
+	offset := *c.committed
+	return &offset
+}
@@ -0,0 +1,145 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type failingOffsetManager struct {
+	err error
+}
+
+func (m *failingOffsetManager) GetOffset(ctx context.Context) (*StreamOffset, error) {
+	return nil, m.err
+}
+
+func (m *failingOffsetManager) SetOffset(ctx context.Context, offset StreamOffset) error {
+	return m.err
+}
+
+func TestConsumer_Run(t *testing.T) {
+	fail := errors.New("offset unavailable")
+	c := NewStreamConsumer[any, any](nil, &Config{TokenManager: &failingOffsetManager{err: fail}})
+
+	status := c.Run(context.Background(), nil, nil)
+	if status.Reason != StopReasonError || !errors.Is(status.Err, fail) {
+		t.Errorf("Run() = %+v, want error reason", status)
+	}
+	if !status.Drained || status.Offset != nil {
+		t.Errorf("Run() = %+v, want drained without offset", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status = c.Run(ctx, nil, nil)
+	if status.Reason != StopReasonShutdown || status.Err != nil {
+		t.Errorf("Run() = %+v, want shutdown reason", status)
+	}
+}
+
+func TestConsumer_runDraining(t *testing.T) {
+	tests := []struct {
+		name        string
+		drain       time.Duration
+		handlerTime time.Duration
+		wantDrained bool
+		wantOffset  *StreamOffset
+	}{
+		{
+			name:        "in-flight handler completes and its offset is committed",
+			drain:       time.Second,
+			handlerTime: 20 * time.Millisecond,
+			wantDrained: true,
+			wantOffset:  &StreamOffset{ResumeToken: "00"},
+		},
+		{
+			name:        "in-flight handler is cancelled when the drain timeout expires",
+			drain:       20 * time.Millisecond,
+			handlerTime: time.Hour,
+			wantDrained: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// events fetched by the same getMore are returned by Next after the shutdown
+			source := &sliceSource{events: []sourceEvent{{raw: insertEvent("00", "a")}, {raw: insertEvent("01", "b")}, {raw: insertEvent("02", "c")}}}
+			om := &countingOffsetManager{}
+			c := NewStreamConsumer[any, string](nil, &Config{TokenManager: om, DrainTimeout: tt.drain})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var handled []string
+			handler := func(hctx context.Context, event StreamEvent[any, string]) error {
+				handled = append(handled, event.ID.Data)
+				cancel()
+				select {
+				case <-time.After(tt.handlerTime):
+					return nil
+				case <-hctx.Done():
+					return hctx.Err()
+				}
+			}
+			status := c.runDraining(ctx, func(ctx, streamCtx context.Context, start *streamStart) (bool, error) {
+				return c.readEvents(ctx, streamCtx, source, func(ctx context.Context, raw bson.Raw, event StreamEvent[any, string]) error {
+					return c.handleEvent(ctx, raw, event, handler)
+				})
+			})
+
+			if status.Reason != StopReasonShutdown || status.Drained != tt.wantDrained {
+				t.Errorf("runDraining() = %+v, want shutdown with drained %v", status, tt.wantDrained)
+			}
+			if !reflect.DeepEqual(status.Offset, tt.wantOffset) {
+				t.Errorf("runDraining() offset = %+v, want %+v", status.Offset, tt.wantOffset)
+			}
+			if !reflect.DeepEqual(handled, []string{"00"}) {
+				t.Errorf("handled %v, want only the in-flight event", handled)
+			}
+		})
+	}
+}
+
+func TestConsumer_StartStop(t *testing.T) {
+	fail := errors.New("offset unavailable")
+	c := NewStreamConsumer[any, any](nil, &Config{TokenManager: &failingOffsetManager{err: fail}})
+
+	if _, err := c.Stop(context.Background()); !errors.Is(err, ErrConsumerNotRunning) {
+		t.Errorf("Stop() error = %v, want %v", err, ErrConsumerNotRunning)
+	}
+	if err := c.Start(context.Background(), nil, nil); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := c.Start(context.Background(), nil, nil); !errors.Is(err, ErrConsumerRunning) {
+		t.Errorf("Start() error = %v, want %v", err, ErrConsumerRunning)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	status, err := c.Stop(ctx)
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if status.Reason == "" {
+		t.Errorf("Stop() returned empty status")
+	}
+	if err := c.Start(context.Background(), nil, nil); err != nil {
+		t.Errorf("Start() after Stop() error = %v", err)
+	}
+}
+
+func TestConsumer_lastCommitted(t *testing.T) {
+	om := NewMemoryOffsetManager(nil)
+	c := NewStreamConsumer[any, any](nil, &Config{TokenManager: om})
+	if c.lastCommitted() != nil {
+		t.Fatalf("lastCommitted() returned an offset before any commit")
+	}
+	if err := c.commitOffset(context.Background(), StreamOffset{ResumeToken: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.lastCommitted(); got == nil || got.ResumeToken != "a" {
+		t.Errorf("lastCommitted() = %+v, want offset a", got)
+	}
+}
@@ -0,0 +1,157 @@
+package stream
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OperationBatch is the operation type reported to Metrics for handlers of ConsumeBatchHandler.
+const OperationBatch = "batch"
+
+// Metrics receives the measurements of a consumer, implementations must be safe for concurrent use.
+// Methods are called synchronously by the consumer and must not block.
+type Metrics interface {
+	// EventReceived is called for each event read from the stream, lag is the wall clock minus the event cluster time.
+	EventReceived(operationType string, lag time.Duration)
+	// HandlerCalled is called after each handler attempt.
+	HandlerCalled(operationType string, duration time.Duration, err error)
+	// HandlerRetried is called before a failed handler is called again, attempt starts from 2.
+	HandlerRetried(operationType string, attempt int)
+	// OffsetCommitted is called after each attempt to save an offset.
+	OffsetCommitted(duration time.Duration, err error)
+	// Reconnected is called when the stream is reopened after a resumable error, attempt starts from 1.
+	Reconnected(attempt int, err error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) EventReceived(string, time.Duration)        {}
+func (noopMetrics) HandlerCalled(string, time.Duration, error) {}
+func (noopMetrics) HandlerRetried(string, int)                 {}
+func (noopMetrics) OffsetCommitted(time.Duration, error)       {}
+func (noopMetrics) Reconnected(int, error)                     {}
+
+// eventLag returns the time elapsed since the event cluster time.
+func eventLag[T any, K any](event StreamEvent[T, K]) time.Duration {
+	if !event.ClusterTimestamp.IsZero() {
+		return time.Since(time.Unix(int64(event.ClusterTimestamp.T), 0))
+	}
+	if event.ClusterTime.IsZero() {
+		return 0
+	}
+	return time.Since(event.ClusterTime)
+}
+
+// meter returns the Metrics of the consumer, a no-op one if none is configured.
+func (c *Consumer[T, K]) meter() Metrics {
+	if c.metrics == nil {
+		return noopMetrics{}
+	}
+	return c.metrics
+}
+
+// received reports an event read from the stream.
+func (c *Consumer[T, K]) received(event StreamEvent[T, K]) {
+	c.meter().EventReceived(event.OperationType, eventLag(event))
+}
+
+// measureHandler wraps fn reporting duration and retries of each attempt.
+func (c *Consumer[T, K]) measureHandler(operationType string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	attempt := 0
+	return func(ctx context.Context) error {
+		attempt++
+		if attempt > 1 {
+			c.meter().HandlerRetried(operationType, attempt)
+		}
+		start := time.Now()
+		err := fn(ctx)
+		c.meter().HandlerCalled(operationType, time.Since(start), err)
+		return err
+	}
+}
+
+// MemoryMetrics is a Metrics which keeps measurements in memory, useful in tests.
+type MemoryMetrics struct {
+	mu       sync.Mutex
+	snapshot MetricsSnapshot
+}
+
+// MetricsSnapshot holds the measurements collected by MemoryMetrics.
+type MetricsSnapshot struct {
+	// Events counts events by operation type.
+	Events map[string]int
+	// Lag is the lag of the last received event.
+	Lag time.Duration
+	// HandlerDurations holds the duration of each handler attempt by operation type.
+	HandlerDurations map[string][]time.Duration
+	HandlerErrors    map[string]int
+	Retries          map[string]int
+	CommitDurations  []time.Duration
+	CommitErrors     int
+	Reconnects       int
+}
+
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{snapshot: MetricsSnapshot{
+		Events:           map[string]int{},
+		HandlerDurations: map[string][]time.Duration{},
+		HandlerErrors:    map[string]int{},
+		Retries:          map[string]int{},
+	}}
+}
+
+func (m *MemoryMetrics) EventReceived(operationType string, lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.Events[operationType]++
+	m.snapshot.Lag = lag
+}
+
+func (m *MemoryMetrics) HandlerCalled(operationType string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.HandlerDurations[operationType] = append(m.snapshot.HandlerDurations[operationType], duration)
+	if err != nil {
+		m.snapshot.HandlerErrors[operationType]++
+	}
+}
+
+func (m *MemoryMetrics) HandlerRetried(operationType string, attempt int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.Retries[operationType]++
+}
+
+func (m *MemoryMetrics) OffsetCommitted(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.CommitDurations = append(m.snapshot.CommitDurations, duration)
+	if err != nil {
+		m.snapshot.CommitErrors++
+	}
+}
+
+func (m *MemoryMetrics) Reconnected(attempt int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot.Reconnects++
+}
+
+// Snapshot returns a copy of the collected measurements.
+func (m *MemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.snapshot
+	s.Events = maps.Clone(s.Events)
+	s.HandlerErrors = maps.Clone(s.HandlerErrors)
+	s.Retries = maps.Clone(s.Retries)
+	s.HandlerDurations = make(map[string][]time.Duration, len(m.snapshot.HandlerDurations))
+	for op, durations := range m.snapshot.HandlerDurations {
+		s.HandlerDurations[op] = slices.Clone(durations)
+	}
+	s.CommitDurations = slices.Clone(s.CommitDurations)
+	return s
+}
@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestEventLag(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		event StreamEvent[any, any]
+		min   time.Duration
+		max   time.Duration
+	}{
+		{
+			name:  "cluster timestamp",
+			event: StreamEvent[any, any]{ClusterTimestamp: bson.Timestamp{T: uint32(now.Add(-time.Minute).Unix())}},
+			min:   time.Minute - time.Second,
+			max:   time.Minute + time.Second,
+		},
+		{
+			name:  "cluster time",
+			event: StreamEvent[any, any]{ClusterTime: now.Add(-time.Second)},
+			min:   time.Second,
+			max:   2 * time.Second,
+		},
+		{
+			name: "no time",
+			max:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventLag(tt.event); got < tt.min || got > tt.max {
+				t.Errorf("eventLag() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestConsumer_metrics(t *testing.T) {
+	ctx := context.Background()
+	metrics := NewMemoryMetrics()
+	c := &Consumer[any, any]{
+		tokenManager: &countingOffsetManager{failures: 1},
+		failure:      FailurePolicy{MaxAttempts: 3, Backoff: Backoff{Initial: time.Millisecond, Max: time.Millisecond}},
+		reconnect:    &ReconnectPolicy{MaxAttempts: 1, Backoff: Backoff{Initial: time.Millisecond, Max: time.Millisecond}},
+		metrics:      metrics,
+	}
+
+	event := StreamEvent[any, any]{OperationType: OperationInsert, ClusterTime: time.Now()}
+	c.received(event)
+	calls := 0
+	err := c.handleEvent(ctx, nil, event, func(ctx context.Context, event StreamEvent[any, any]) error {
+		calls++
+		if calls == 1 {
+			return errors.New("fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("handleEvent() error = %v", err)
+	}
+	resumable := mongo.CommandError{Code: 43}
+	c.supervise(ctx, nil, func(ctx context.Context, start *streamStart) (bool, error) {
+		return false, resumable
+	})
+
+	got := metrics.Snapshot()
+	if got.Events[OperationInsert] != 1 {
+		t.Errorf("Events = %v, want 1 insert", got.Events)
+	}
+	if len(got.HandlerDurations[OperationInsert]) != 2 || got.HandlerErrors[OperationInsert] != 1 || got.Retries[OperationInsert] != 1 {
+		t.Errorf("handler metrics = %v, %v, %v, want 2 attempts, 1 error, 1 retry",
+			got.HandlerDurations, got.HandlerErrors, got.Retries)
+	}
+	if len(got.CommitDurations) != 2 || got.CommitErrors != 1 {
+		t.Errorf("commit metrics = %v, %d errors, want 2 attempts, 1 error", got.CommitDurations, got.CommitErrors)
+	}
+	if got.Reconnects != 1 {
+		t.Errorf("Reconnects = %d, want 1", got.Reconnects)
+	}
+}
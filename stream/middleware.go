@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// Middleware wraps a HandlerFn adding behaviour before or after it.
+type Middleware[T any, K any] func(HandlerFn[T, K]) HandlerFn[T, K]
+
+// Chain returns a Middleware which applies middlewares in order, the first one is the outermost.
+func Chain[T any, K any](middlewares ...Middleware[T, K]) Middleware[T, K] {
+	return func(handler HandlerFn[T, K]) HandlerFn[T, K] {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
+
+// PanicError is returned by handlers wrapped with Recover when they panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", e.Value)
+}
+
+// Recover turns panics of the handler into a *PanicError, so that they are handled by the failure policy.
+func Recover[T any, K any]() Middleware[T, K] {
+	return func(next HandlerFn[T, K]) HandlerFn[T, K] {
+		return func(ctx context.Context, event StreamEvent[T, K]) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, event)
+		}
+	}
+}
+
+// Timeout cancels the context of each handler call after d.
+func Timeout[T any, K any](d time.Duration) Middleware[T, K] {
+	return func(next HandlerFn[T, K]) HandlerFn[T, K] {
+		return func(ctx context.Context, event StreamEvent[T, K]) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, event)
+		}
+	}
+}
+
+// Logging logs each handled event with its token, operation type, namespace, document key and duration.
+// Handled events are logged at debug level, failures at error level.
+func Logging[T any, K any](logger *slog.Logger) Middleware[T, K] {
+	return func(next HandlerFn[T, K]) HandlerFn[T, K] {
+		return func(ctx context.Context, event StreamEvent[T, K]) error {
+			start := time.Now()
+			err := next(ctx, event)
+			attrs := []slog.Attr{
+				slog.String("token", event.ID.Data),
+				slog.String("operationType", event.OperationType),
+				slog.String("ns", event.NS.DB+"."+event.NS.Coll),
+				slog.Any("documentKey", event.DocumentKey.ID),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+				logger.LogAttrs(ctx, slog.LevelError, "stream event handler failed", attrs...)
+				return err
+			}
+			logger.LogAttrs(ctx, slog.LevelDebug, "stream event handled", attrs...)
+			return nil
+		}
+	}
+}
+
+// FilterOperations calls the handler only for events with one of given operation types, others are skipped.
+func FilterOperations[T any, K any](operationTypes ...string) Middleware[T, K] {
+	return func(next HandlerFn[T, K]) HandlerFn[T, K] {
+		return func(ctx context.Context, event StreamEvent[T, K]) error {
+			if !slices.Contains(operationTypes, event.OperationType) {
+				return nil
+			}
+			return next(ctx, event)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware[any, any] {
+		return func(next HandlerFn[any, any]) HandlerFn[any, any] {
+			return func(ctx context.Context, event StreamEvent[any, any]) error {
+				calls = append(calls, name)
+				return next(ctx, event)
+			}
+		}
+	}
+	handler := Chain(trace("a"), trace("b"))(func(ctx context.Context, event StreamEvent[any, any]) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	if err := handler(context.Background(), StreamEvent[any, any]{}); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if want := []string{"a", "b", "handler"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := Recover[any, any]()(func(ctx context.Context, event StreamEvent[any, any]) error {
+		panic("boom")
+	})
+	err := handler(context.Background(), StreamEvent[any, any]{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("handler() error = %v, want *PanicError", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	handler := Timeout[any, any](time.Millisecond)(func(ctx context.Context, event StreamEvent[any, any]) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := handler(context.Background(), StreamEvent[any, any]{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	fail := errors.New("fail")
+	handler := Logging[any, any](logger)(func(ctx context.Context, event StreamEvent[any, any]) error {
+		if event.OperationType == OperationDelete {
+			return fail
+		}
+		return nil
+	})
+
+	event := StreamEvent[any, any]{OperationType: OperationInsert}
+	event.ID.Data = "token1"
+	event.NS.DB, event.NS.Coll = "app", "users"
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	event.OperationType = OperationDelete
+	if err := handler(context.Background(), event); !errors.Is(err, fail) {
+		t.Fatalf("handler() error = %v, want %v", err, fail)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	for _, want := range []string{"level=DEBUG", "token=token1", "operationType=insert", "ns=app.users"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("log %q does not contain %q", lines[0], want)
+		}
+	}
+	if !strings.Contains(lines[1], "level=ERROR") || !strings.Contains(lines[1], "error=fail") {
+		t.Errorf("log %q, want error", lines[1])
+	}
+}
+
+func TestFilterOperations(t *testing.T) {
+	var handled []string
+	handler := FilterOperations[any, any](OperationInsert, OperationUpdate)(func(ctx context.Context, event StreamEvent[any, any]) error {
+		handled = append(handled, event.OperationType)
+		return nil
+	})
+	for _, op := range []string{OperationInsert, OperationDelete, OperationUpdate} {
+		if err := handler(context.Background(), StreamEvent[any, any]{OperationType: op}); err != nil {
+			t.Fatalf("handler() error = %v", err)
+		}
+	}
+	if want := []string{OperationInsert, OperationUpdate}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled = %v, want %v", handled, want)
+	}
+}
@@ -17,18 +17,31 @@ type StreamEvent[T any, K any] struct {
 	OperationType            string             `bson:"operationType" json:"operationType"`
 	FullDocument             T                  `bson:"fullDocument" json:"fullDocument"`
 	ClusterTime              time.Time          `bson:"clusterTime" json:"clusterTime"`
+	ClusterTimestamp         bson.Timestamp     `bson:"-" json:"-"`                                               // exact clusterTime, set by Consumer
 	FullDocumentBeforeChange *T                 `bson:"fullDocumentBeforeChange" json:"fullDocumentBeforeChange"` // needs changeStreamPreAndPostImages
 	UpdateDescription        *UpdateDescription `bson:"updateDescription" json:"updateDescription"`
 	NS                       struct {
 		DB   string `bson:"db" json:"db"`
 		Coll string `bson:"coll" json:"coll"`
 	} `bson:"ns" json:"ns"`
+	To *Namespace `bson:"to,omitempty" json:"to,omitempty"` // set by rename events
 }
 
 func (s StreamEvent[T, K]) GetStreamOffset() *StreamOffset {
 	return &StreamOffset{
 		ResumeToken: s.ID.Data,
 		Timestamp:   s.ClusterTime,
+		ClusterTime: s.ClusterTimestamp,
+	}
+}
+
+// setClusterTimestamp reads the exact clusterTime from raw event,
+// since decoding it into time.Time drops the ordinal.
+func (s *StreamEvent[T, K]) setClusterTimestamp(raw bson.Raw) {
+	if v, err := raw.LookupErr("clusterTime"); err == nil {
+		if t, i, ok := v.TimestampOK(); ok {
+			s.ClusterTimestamp = bson.Timestamp{T: t, I: i}
+		}
 	}
 }
 
@@ -41,6 +54,7 @@ type UpdateDescription struct {
 	TruncatedArrays []TruncatedArrayElement `bson:"truncatedArrays" json:"truncatedArrays"`
 }
 
+// Deprecated: use DecodeUpdatedFields, which supports dotted keys and returns errors instead of panicking.
 func (ud UpdateDescription) GetUpdatedObject(t reflect.Type) interface{} {
 	if t.Kind() != reflect.Struct {
 		panic("type must be struct")
@@ -68,8 +82,26 @@ type TruncatedArrayElement struct {
 type StreamOffset struct {
 	ResumeToken string    `json:"token"`
 	Timestamp   time.Time `json:"ts"`
+	// ClusterTime is the exact cluster time of the event, Timestamp has only seconds precision
+	// for resuming. It is zero for offsets stored before it was introduced.
+	ClusterTime bson.Timestamp `json:"clusterTime"`
+	// Snapshot is set while ConsumeWithSnapshot is scanning the collection.
+	Snapshot *SnapshotOffset `json:"snapshot,omitempty"`
+}
+
+// operationTime returns the cluster time to start a stream from.
+func (o StreamOffset) operationTime() bson.Timestamp {
+	if !o.ClusterTime.IsZero() {
+		return o.ClusterTime
+	}
+	return bson.Timestamp{T: uint32(o.Timestamp.UTC().Unix()), I: 0}
 }
 
 type EventEncoder interface {
 	Encode(raw []byte) ([]byte, error)
 }
+
+// EventDecoder reverts an EventEncoder.
+type EventDecoder interface {
+	Decode(raw []byte) ([]byte, error)
+}
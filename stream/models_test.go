@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestStreamEvent_setClusterTimestamp(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "operationType", Value: "insert"},
+		{Key: "clusterTime", Value: bson.Timestamp{T: 1714557600, I: 7}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event StreamEvent[bson.M, bson.ObjectID]
+	if err := bson.Unmarshal(raw, &event); err != nil {
+		t.Fatal(err)
+	}
+	event.setClusterTimestamp(raw)
+
+	offset := event.GetStreamOffset()
+	if offset.ClusterTime != (bson.Timestamp{T: 1714557600, I: 7}) {
+		t.Errorf("GetStreamOffset().ClusterTime = %+v", offset.ClusterTime)
+	}
+	if offset.Timestamp.Unix() != 1714557600 {
+		t.Errorf("GetStreamOffset().Timestamp = %v", offset.Timestamp)
+	}
+}
+
+func TestStreamOffset_operationTime(t *testing.T) {
+	ts := time.Unix(1714557600, 0)
+	tests := []struct {
+		name   string
+		offset StreamOffset
+		want   bson.Timestamp
+	}{
+		{
+			name:   "exact cluster time is preferred",
+			offset: StreamOffset{Timestamp: ts, ClusterTime: bson.Timestamp{T: 1714557600, I: 3}},
+			want:   bson.Timestamp{T: 1714557600, I: 3},
+		},
+		{
+			name:   "legacy offset falls back to timestamp",
+			offset: StreamOffset{Timestamp: ts},
+			want:   bson.Timestamp{T: 1714557600, I: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.offset.operationTime(); got != tt.want {
+				t.Errorf("operationTime() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamOffset_JSON(t *testing.T) {
+	var legacy StreamOffset
+	if err := json.Unmarshal([]byte(`{"token":"abc","ts":"2024-05-01T10:00:00Z"}`), &legacy); err != nil {
+		t.Fatalf("Unmarshal() legacy offset error = %v", err)
+	}
+	if legacy.ResumeToken != "abc" || legacy.Timestamp.IsZero() || !legacy.ClusterTime.IsZero() {
+		t.Errorf("Unmarshal() legacy offset = %+v", legacy)
+	}
+
+	offset := StreamOffset{ResumeToken: "abc", Timestamp: time.Unix(10, 0).UTC(), ClusterTime: bson.Timestamp{T: 10, I: 2}}
+	b, err := json.Marshal(offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got StreamOffset
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != offset {
+		t.Errorf("JSON round trip = %+v, want %+v", got, offset)
+	}
+}
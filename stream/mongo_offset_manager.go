@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mwerrors "github.com/YoungAgency/mongo-wrapper/v2/errors"
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// OffsetCollection is the subset of *mongo.Collection used by MongoOffsetManager.
+type OffsetCollection interface {
+	FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
+	UpdateOne(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error)
+}
+
+// MongoOffsetManager stores offsets in a MongoDB collection, one document per consumer.
+type MongoOffsetManager struct {
+	collection OffsetCollection
+	consumer   string
+	monotonic  bool
+	lease      *Lease
+}
+
+// offsetDocument is the document stored by MongoOffsetManager.
+type offsetDocument struct {
+	Consumer    string          `bson:"_id"`
+	ResumeToken string          `bson:"token"`
+	Timestamp   time.Time       `bson:"ts"`
+	ClusterTime bson.Timestamp  `bson:"ct"`
+	Snapshot    *SnapshotOffset `bson:"snapshot,omitempty"`
+	Fence       int64           `bson:"fence,omitempty"`
+	UpdatedAt   time.Time       `bson:"updatedAt"`
+}
+
+// NewMongoOffsetManager returns an OffsetManager which stores offsets in collection using consumer as document _id.
+// If monotonic is true, offsets older than the stored one are ignored, so that the offset never moves backwards.
+// Offsets are compared by exact cluster time when available, by timestamp otherwise.
+// Reset offsets (empty token and timestamp) are always written.
+func NewMongoOffsetManager(collection OffsetCollection, consumer string, monotonic bool) *MongoOffsetManager {
+	return &MongoOffsetManager{
+		collection: collection,
+		consumer:   consumer,
+		monotonic:  monotonic,
+	}
+}
+
+// WithLease makes SetOffset fail with ErrLeaseLost unless lease is held and its fencing token
+// is not older than the one of the last stored offset.
+func (m *MongoOffsetManager) WithLease(lease *Lease) *MongoOffsetManager {
+	m.lease = lease
+	return m
+}
+
+func (m *MongoOffsetManager) GetOffset(ctx context.Context) (*StreamOffset, error) {
+	filter := query.NewFilterBuilder().Eq("_id", m.consumer).Build()
+	var doc offsetDocument
+	if err := m.collection.FindOne(ctx, filter).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &StreamOffset{
+		ResumeToken: doc.ResumeToken,
+		Timestamp:   doc.Timestamp,
+		ClusterTime: doc.ClusterTime,
+		Snapshot:    doc.Snapshot,
+	}, nil
+}
+
+func (m *MongoOffsetManager) SetOffset(ctx context.Context, offset StreamOffset) error {
+	filter := query.NewFilterBuilder().Eq("_id", m.consumer)
+	update := query.NewUpdateBuilder().
+		Set("token", offset.ResumeToken).
+		Set("ts", offset.Timestamp).
+		Set("ct", offset.ClusterTime).
+		Set("snapshot", offset.Snapshot).
+		Set("updatedAt", time.Now())
+
+	var conditions bson.A
+	reset := offset.ResumeToken == "" && offset.Timestamp.IsZero() && offset.ClusterTime.IsZero() && offset.Snapshot == nil
+	if m.monotonic && !reset {
+		field, value := "ts", any(offset.Timestamp)
+		if !offset.ClusterTime.IsZero() {
+			field, value = "ct", offset.ClusterTime
+		}
+		conditions = append(conditions, orMissing(field, value))
+	}
+	var fence int64
+	if m.lease != nil {
+		var held bool
+		if fence, held = m.lease.FencingToken(); !held {
+			return ErrLeaseLost
+		}
+		conditions = append(conditions, orMissing("fence", fence))
+		update.Set("fence", fence)
+	}
+	switch len(conditions) {
+	case 0:
+	case 1:
+		filter.Append(conditions[0].(bson.D)[0])
+	default:
+		filter.Append(bson.E{Key: "$and", Value: conditions})
+	}
+
+	if len(conditions) > 0 && mongo.SessionFromContext(ctx) != nil {
+		return m.setOffsetInTransaction(ctx, filter.Build(), update.Build(), fence)
+	}
+	_, err := m.collection.UpdateOne(ctx, filter.Build(), update.Build(), options.UpdateOne().SetUpsert(true))
+	if err == nil || !mwerrors.DuplicateKey(err) {
+		return err
+	}
+	// upsert failed inserting a document with the same _id, the stored offset did not match conditions
+	if m.lease != nil {
+		var doc offsetDocument
+		if err := m.collection.FindOne(ctx, query.NewFilterBuilder().Eq("_id", m.consumer).Build()).Decode(&doc); err != nil {
+			return err
+		}
+		if doc.Fence > fence {
+			return ErrLeaseLost
+		}
+	}
+	if m.monotonic {
+		// stored offset is newer
+		return nil
+	}
+	return err
+}
+
+// setOffsetInTransaction saves the offset if the stored one matches filter without relying on a failing upsert,
+// since a duplicate key error aborts the transaction.
+func (m *MongoOffsetManager) setOffsetInTransaction(ctx context.Context, filter, update bson.D, fence int64) error {
+	var doc offsetDocument
+	err := m.collection.FindOne(ctx, query.NewFilterBuilder().Eq("_id", m.consumer).Build()).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		_, err = m.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if m.lease != nil && doc.Fence > fence {
+		return ErrLeaseLost
+	}
+	// if nothing matched the stored offset is newer
+	_, err = m.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// orMissing returns a filter matching documents whose field is less than or equal to value, or missing.
+func orMissing(field string, value any) bson.D {
+	return bson.D{{
+		Key: "$or",
+		Value: bson.A{
+			query.FieldCompare(field, "<=", value),
+			query.NewFilterBuilder().NotExists(field).Build(),
+		},
+	}}
+}
@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// memoryCollection is an in-memory stand-in for *mongo.Collection supporting
+// the filters and updates used by the offset managers.
+type memoryCollection struct {
+	mu   sync.Mutex
+	docs map[any]bson.M
+	// aborted records a duplicate key error within a session, which aborts a transaction.
+	aborted bool
+}
+
+func newMemoryCollection() *memoryCollection {
+	return &memoryCollection{docs: make(map[any]bson.M)}
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, doc := range c.docs {
+		if matchFilter(doc, filter.(bson.D)) {
+			return mongo.NewSingleResultFromDocument(doc, nil, nil)
+		}
+	}
+	return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var docs []any
+	for _, doc := range c.docs {
+		if matchFilter(doc, filter.(bson.D)) {
+			docs = append(docs, doc)
+		}
+	}
+	return mongo.NewCursorFromDocuments(docs, nil, nil)
+}
+
+func (c *memoryCollection) UpdateOne(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := filter.(bson.D)
+	for _, doc := range c.docs {
+		if matchFilter(doc, f) {
+			applyUpdate(doc, update.(bson.D))
+			return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+		}
+	}
+	args := &options.UpdateOneOptions{}
+	for _, opt := range opts {
+		for _, set := range opt.List() {
+			set(args)
+		}
+	}
+	if args.Upsert == nil || !*args.Upsert {
+		return &mongo.UpdateResult{}, nil
+	}
+	var id any
+	for _, e := range f {
+		if e.Key == "_id" {
+			id = e.Value
+			if cond, ok := e.Value.(bson.D); ok {
+				id = cond[0].Value
+			}
+		}
+	}
+	if _, ok := c.docs[id]; ok {
+		c.aborted = c.aborted || mongo.SessionFromContext(ctx) != nil
+		return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}
+	}
+	doc := bson.M{"_id": id}
+	applyUpdate(doc, update.(bson.D))
+	c.docs[id] = doc
+	return &mongo.UpdateResult{UpsertedCount: 1, UpsertedID: id}, nil
+}
+
+func matchFilter(doc bson.M, filter bson.D) bool {
+	for _, e := range filter {
+		switch e.Key {
+		case "$and":
+			for _, sub := range e.Value.(bson.A) {
+				if !matchFilter(doc, sub.(bson.D)) {
+					return false
+				}
+			}
+		case "$or":
+			matched := false
+			for _, sub := range e.Value.(bson.A) {
+				if matchFilter(doc, sub.(bson.D)) {
+					matched = true
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			value, exists := doc[e.Key]
+			cond, ok := e.Value.(bson.D)
+			if !ok {
+				if !exists || value != e.Value {
+					return false
+				}
+				continue
+			}
+			for _, op := range cond {
+				switch op.Key {
+				case "$eq":
+					if !exists || value != op.Value {
+						return false
+					}
+				case "$exists":
+					if exists != op.Value.(bool) {
+						return false
+					}
+				case "$lte":
+					if !exists || compareValues(value, op.Value) > 0 {
+						return false
+					}
+				case "$gt":
+					if !exists || compareValues(value, op.Value) <= 0 {
+						return false
+					}
+				case "$lt":
+					if !exists || compareValues(value, op.Value) >= 0 {
+						return false
+					}
+				default:
+					panic("unsupported operator " + op.Key)
+				}
+			}
+		}
+	}
+	return true
+}
+
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bson.Timestamp:
+		return a.Compare(b.(bson.Timestamp))
+	case int64:
+		b := b.(int64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	}
+	panic("unsupported value")
+}
+
+func applyUpdate(doc bson.M, update bson.D) {
+	for _, e := range update {
+		switch e.Key {
+		case "$set":
+			for _, f := range e.Value.(bson.D) {
+				doc[f.Key] = f.Value
+			}
+		case "$inc":
+			for _, f := range e.Value.(bson.D) {
+				v, _ := doc[f.Key].(int64)
+				doc[f.Key] = v + f.Value.(int64)
+			}
+		default:
+			panic("unsupported update " + e.Key)
+		}
+	}
+}
+
+func TestMongoOffsetManager(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	m := NewMongoOffsetManager(coll, "consumer", false)
+
+	got, err := m.GetOffset(ctx)
+	if err != nil || got != nil {
+		t.Fatalf("GetOffset() = %v, %v, want nil, nil", got, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if err := m.SetOffset(ctx, StreamOffset{ResumeToken: "b", Timestamp: now}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	if err := m.SetOffset(ctx, StreamOffset{ResumeToken: "a", Timestamp: now.Add(-time.Second)}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	got, err = m.GetOffset(ctx)
+	if err != nil || got.ResumeToken != "a" || !got.Timestamp.Equal(now.Add(-time.Second)) {
+		t.Errorf("GetOffset() = %+v, %v, want offset a", got, err)
+	}
+
+	other := NewMongoOffsetManager(coll, "other", false)
+	if got, _ := other.GetOffset(ctx); got != nil {
+		t.Errorf("GetOffset() = %+v, offsets are not isolated by consumer", got)
+	}
+}
+
+func TestMongoOffsetManager_monotonic(t *testing.T) {
+	ctx := context.Background()
+	m := NewMongoOffsetManager(newMemoryCollection(), "consumer", true)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	if err := m.SetOffset(ctx, StreamOffset{ResumeToken: "b", Timestamp: now}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	if err := m.SetOffset(ctx, StreamOffset{ResumeToken: "a", Timestamp: now.Add(-time.Second)}); err != nil {
+		t.Fatalf("SetOffset() with older offset error = %v", err)
+	}
+	got, _ := m.GetOffset(ctx)
+	if got.ResumeToken != "b" {
+		t.Errorf("GetOffset() = %+v, offset moved backwards", got)
+	}
+
+	if err := m.SetOffset(ctx, StreamOffset{ResumeToken: "c", Timestamp: now.Add(time.Second)}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	got, _ = m.GetOffset(ctx)
+	if got.ResumeToken != "c" {
+		t.Errorf("GetOffset() = %+v, want offset c", got)
+	}
+
+	if err := m.SetOffset(ctx, StreamOffset{}); err != nil {
+		t.Fatalf("SetOffset() reset error = %v", err)
+	}
+	got, _ = m.GetOffset(ctx)
+	if got.ResumeToken != "" || !got.Timestamp.IsZero() {
+		t.Errorf("GetOffset() = %+v, want reset offset", got)
+	}
+}
+
+func TestMongoOffsetManager_monotonicClusterTime(t *testing.T) {
+	ctx := context.Background()
+	m := NewMongoOffsetManager(newMemoryCollection(), "consumer", true)
+	ts := time.Now().UTC().Truncate(time.Second)
+
+	for _, offset := range []StreamOffset{
+		{ResumeToken: "a", Timestamp: ts, ClusterTime: bson.Timestamp{T: uint32(ts.Unix()), I: 1}},
+		{ResumeToken: "c", Timestamp: ts, ClusterTime: bson.Timestamp{T: uint32(ts.Unix()), I: 3}},
+		{ResumeToken: "b", Timestamp: ts, ClusterTime: bson.Timestamp{T: uint32(ts.Unix()), I: 2}},
+	} {
+		if err := m.SetOffset(ctx, offset); err != nil {
+			t.Fatalf("SetOffset() error = %v", err)
+		}
+	}
+	got, _ := m.GetOffset(ctx)
+	if got.ResumeToken != "c" || got.ClusterTime.I != 3 {
+		t.Errorf("GetOffset() = %+v, want offset c", got)
+	}
+}
@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RawEvent is a change event whose documents and key are left undecoded,
+// it is used by consumers watching several collections with different document types.
+type RawEvent = StreamEvent[bson.Raw, bson.RawValue]
+
+// Namespace identifies a collection, an empty Coll matches every collection of DB.
+type Namespace struct {
+	DB   string `bson:"db" json:"db"`
+	Coll string `bson:"coll" json:"coll"`
+}
+
+// NamespaceRouter dispatches RawEvent to handlers registered by namespace,
+// decoding them into the types expected by each handler.
+// Use it as handler of a Consumer[bson.Raw, bson.RawValue] watching a database or the whole cluster.
+type NamespaceRouter struct {
+	registry *bson.Registry
+	routes   map[Namespace]HandlerFn[bson.Raw, bson.RawValue]
+	fallback HandlerFn[bson.Raw, bson.RawValue]
+}
+
+// NewNamespaceRouter returns an empty router, registry is used to decode events and may be nil.
+func NewNamespaceRouter(registry *bson.Registry) *NamespaceRouter {
+	return &NamespaceRouter{
+		registry: registry,
+		routes:   make(map[Namespace]HandlerFn[bson.Raw, bson.RawValue]),
+	}
+}
+
+// Route registers handler for events of given namespace.
+// Events are decoded into StreamEvent[T, K] before handler is called.
+func Route[T any, K any](r *NamespaceRouter, ns Namespace, handler HandlerFn[T, K]) *NamespaceRouter {
+	r.routes[ns] = func(ctx context.Context, event RawEvent) error {
+		decoded, err := convertEvent[T, K](r.registry, event)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, decoded)
+	}
+	return r
+}
+
+// Default registers the handler called for events without a route, they are ignored otherwise.
+func (r *NamespaceRouter) Default(handler HandlerFn[bson.Raw, bson.RawValue]) *NamespaceRouter {
+	r.fallback = handler
+	return r
+}
+
+// Handler returns the HandlerFn to pass to the consumer.
+// An exact namespace route is preferred over a database route.
+func (r *NamespaceRouter) Handler() HandlerFn[bson.Raw, bson.RawValue] {
+	return func(ctx context.Context, event RawEvent) error {
+		if handler, ok := r.routes[Namespace(event.NS)]; ok {
+			return handler(ctx, event)
+		}
+		if handler, ok := r.routes[Namespace{DB: event.NS.DB}]; ok {
+			return handler(ctx, event)
+		}
+		if r.fallback != nil {
+			return r.fallback(ctx, event)
+		}
+		return nil
+	}
+}
+
+// ConvertEvent decodes documents and key of a RawEvent into StreamEvent[T, K].
+func ConvertEvent[T any, K any](event RawEvent) (StreamEvent[T, K], error) {
+	return convertEvent[T, K](nil, event)
+}
+
+func convertEvent[T any, K any](registry *bson.Registry, event RawEvent) (StreamEvent[T, K], error) {
+	out := StreamEvent[T, K]{
+		ID:                event.ID,
+		OperationType:     event.OperationType,
+		ClusterTime:       event.ClusterTime,
+		ClusterTimestamp:  event.ClusterTimestamp,
+		UpdateDescription: event.UpdateDescription,
+		NS:                event.NS,
+		To:                event.To,
+	}
+	if len(event.FullDocument) > 0 {
+		if err := decodeRaw(registry, event.FullDocument, &out.FullDocument); err != nil {
+			return out, err
+		}
+	}
+	if event.FullDocumentBeforeChange != nil && len(*event.FullDocumentBeforeChange) > 0 {
+		out.FullDocumentBeforeChange = new(T)
+		if err := decodeRaw(registry, *event.FullDocumentBeforeChange, out.FullDocumentBeforeChange); err != nil {
+			return out, err
+		}
+	}
+	if key := event.DocumentKey.ID; key.Type != 0 && key.Type != bson.TypeNull {
+		if err := decodeRawValue(registry, key, &out.DocumentKey.ID); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func decodeRaw(registry *bson.Registry, raw bson.Raw, v any) error {
+	if registry == nil {
+		return bson.Unmarshal(raw, v)
+	}
+	dec := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(raw)))
+	dec.SetRegistry(registry)
+	return dec.Decode(v)
+}
+
+func decodeRawValue(registry *bson.Registry, raw bson.RawValue, v any) error {
+	if registry == nil {
+		return raw.Unmarshal(v)
+	}
+	return raw.UnmarshalWithRegistry(registry, v)
+}
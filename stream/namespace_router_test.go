@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type testUser struct {
+	Name string `bson:"name"`
+}
+
+type testOrder struct {
+	Total int `bson:"total"`
+}
+
+func rawEvent(t *testing.T, doc bson.D) RawEvent {
+	t.Helper()
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event RawEvent
+	if err := bson.Unmarshal(b, &event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestNamespaceRouter(t *testing.T) {
+	userID := bson.NewObjectID()
+	var users []StreamEvent[testUser, bson.ObjectID]
+	var orders []StreamEvent[testOrder, int32]
+	var other []RawEvent
+
+	router := NewNamespaceRouter(nil)
+	Route(router, Namespace{DB: "app", Coll: "users"}, func(ctx context.Context, event StreamEvent[testUser, bson.ObjectID]) error {
+		users = append(users, event)
+		return nil
+	})
+	Route(router, Namespace{DB: "shop"}, func(ctx context.Context, event StreamEvent[testOrder, int32]) error {
+		orders = append(orders, event)
+		return nil
+	})
+	router.Default(func(ctx context.Context, event RawEvent) error {
+		other = append(other, event)
+		return nil
+	})
+	handler := router.Handler()
+
+	events := []bson.D{
+		{
+			{Key: "_id", Value: bson.D{{Key: "_data", Value: "1"}}},
+			{Key: "operationType", Value: "insert"},
+			{Key: "ns", Value: bson.D{{Key: "db", Value: "app"}, {Key: "coll", Value: "users"}}},
+			{Key: "documentKey", Value: bson.D{{Key: "_id", Value: userID}}},
+			{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: userID}, {Key: "name", Value: "john"}}},
+		},
+		{
+			{Key: "_id", Value: bson.D{{Key: "_data", Value: "2"}}},
+			{Key: "operationType", Value: "insert"},
+			{Key: "ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "coll", Value: "orders_tenant1"}}},
+			{Key: "documentKey", Value: bson.D{{Key: "_id", Value: int32(7)}}},
+			{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: int32(7)}, {Key: "total", Value: 42}}},
+		},
+		{
+			{Key: "_id", Value: bson.D{{Key: "_data", Value: "3"}}},
+			{Key: "operationType", Value: "delete"},
+			{Key: "ns", Value: bson.D{{Key: "db", Value: "app"}, {Key: "coll", Value: "logs"}}},
+			{Key: "documentKey", Value: bson.D{{Key: "_id", Value: "x"}}},
+		},
+	}
+	for _, doc := range events {
+		if err := handler(context.Background(), rawEvent(t, doc)); err != nil {
+			t.Fatalf("handler() error = %v", err)
+		}
+	}
+
+	if len(users) != 1 || users[0].FullDocument.Name != "john" || users[0].DocumentKey.ID != userID || users[0].ID.Data != "1" {
+		t.Errorf("users route got %+v", users)
+	}
+	if len(orders) != 1 || orders[0].FullDocument.Total != 42 || orders[0].DocumentKey.ID != 7 || orders[0].NS.Coll != "orders_tenant1" {
+		t.Errorf("database route got %+v", orders)
+	}
+	if len(other) != 1 || other[0].NS.Coll != "logs" {
+		t.Errorf("default route got %+v", other)
+	}
+}
+
+func TestConvertEvent_beforeChange(t *testing.T) {
+	event := rawEvent(t, bson.D{
+		{Key: "operationType", Value: "update"},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: "a"}}},
+		{Key: "fullDocumentBeforeChange", Value: bson.D{{Key: "name", Value: "old"}}},
+		{Key: "updateDescription", Value: bson.D{{Key: "updatedFields", Value: bson.D{{Key: "name", Value: "new"}}}}},
+	})
+	got, err := ConvertEvent[testUser, string](event)
+	if err != nil {
+		t.Fatalf("ConvertEvent() error = %v", err)
+	}
+	if got.FullDocumentBeforeChange == nil || got.FullDocumentBeforeChange.Name != "old" {
+		t.Errorf("ConvertEvent() before change = %+v", got.FullDocumentBeforeChange)
+	}
+	if got.DocumentKey.ID != "a" || got.UpdateDescription == nil {
+		t.Errorf("ConvertEvent() = %+v", got)
+	}
+}
+
+func TestConsumer_getStream_collectionWithoutDatabase(t *testing.T) {
+	c := NewStreamConsumer[any, any](nil, &Config{Collection: "users"})
+	if _, err := c.getStream(context.Background(), nil, cloneStreamOptions(nil)); !errors.Is(err, ErrCollectionWithoutDatabase) {
+		t.Errorf("getStream() error = %v, want %v instead of watching the cluster", err, ErrCollectionWithoutDatabase)
+	}
+}
@@ -2,6 +2,8 @@ package stream
 
 import (
 	"context"
+	"slices"
+	"sync"
 )
 
 type OffsetManager interface {
@@ -20,6 +22,49 @@ func (d *defaultOffsetManager) SetOffset(ctx context.Context, offset StreamOffse
 	return nil
 }
 
+// MemoryOffsetManager keeps offsets in memory and records every committed offset.
+// It is safe for concurrent use and meant for tests and local runs.
+type MemoryOffsetManager struct {
+	mu      sync.Mutex
+	initial *StreamOffset
+	history []StreamOffset
+}
+
+// NewMemoryOffsetManager returns a MemoryOffsetManager, initial is returned by GetOffset until an offset is set.
+func NewMemoryOffsetManager(initial *StreamOffset) *MemoryOffsetManager {
+	return &MemoryOffsetManager{
+		initial: initial,
+	}
+}
+
+func (m *MemoryOffsetManager) GetOffset(ctx context.Context) (*StreamOffset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.history) == 0 {
+		if m.initial == nil {
+			return nil, nil
+		}
+		offset := *m.initial
+		return &offset, nil
+	}
+	offset := m.history[len(m.history)-1]
+	return &offset, nil
+}
+
+func (m *MemoryOffsetManager) SetOffset(ctx context.Context, offset StreamOffset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = append(m.history, offset)
+	return nil
+}
+
+// History returns every offset set so far, in commit order.
+func (m *MemoryOffsetManager) History() []StreamOffset {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.history)
+}
+
 /*
 func (d *RedisOffsetManager) GetOffset(ctx context.Context) (*StreamOffset, error) {
 	conn, err := d.pool.GetContext(ctx)
@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileOffsetManager(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "offset.json")
+	m := NewFileOffsetManager(path)
+
+	got, err := m.GetOffset(ctx)
+	if err != nil || got != nil {
+		t.Fatalf("GetOffset() = %v, %v, want nil, nil", got, err)
+	}
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, token := range []string{"a", "b"} {
+		if err := m.SetOffset(ctx, StreamOffset{ResumeToken: token, Timestamp: ts}); err != nil {
+			t.Fatalf("SetOffset() error = %v", err)
+		}
+	}
+	got, err = m.GetOffset(ctx)
+	if err != nil || got.ResumeToken != "b" || !got.Timestamp.Equal(ts) {
+		t.Errorf("GetOffset() = %+v, %v, want offset b", got, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("SetOffset() left %d files in directory, want 1", len(entries))
+	}
+}
+
+func TestFileOffsetManager_format(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offset.json")
+	err := os.WriteFile(path, []byte(`{"token":"abc","ts":"2024-05-01T10:00:00Z"}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewFileOffsetManager(path).GetOffset(context.Background())
+	if err != nil {
+		t.Fatalf("GetOffset() error = %v", err)
+	}
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if got.ResumeToken != "abc" || !got.Timestamp.Equal(want) {
+		t.Errorf("GetOffset() = %+v", got)
+	}
+}
+
+func TestMemoryOffsetManager(t *testing.T) {
+	ctx := context.Background()
+	initial := &StreamOffset{ResumeToken: "initial"}
+	m := NewMemoryOffsetManager(initial)
+
+	got, _ := m.GetOffset(ctx)
+	if got.ResumeToken != "initial" {
+		t.Errorf("GetOffset() = %+v, want initial offset", got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.SetOffset(ctx, StreamOffset{ResumeToken: "concurrent"})
+		}()
+	}
+	wg.Wait()
+	m.SetOffset(ctx, StreamOffset{ResumeToken: "last"})
+
+	history := m.History()
+	if len(history) != 11 {
+		t.Fatalf("History() has %d offsets, want 11", len(history))
+	}
+	if history[10].ResumeToken != "last" {
+		t.Errorf("History() last offset = %+v", history[10])
+	}
+	got, _ = m.GetOffset(ctx)
+	if !reflect.DeepEqual(*got, history[10]) {
+		t.Errorf("GetOffset() = %+v, want %+v", got, history[10])
+	}
+}
@@ -0,0 +1,271 @@
+package stream
+
+import (
+	"context"
+	"slices"
+
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Change event operation types.
+const (
+	OperationInsert       = "insert"
+	OperationUpdate       = "update"
+	OperationReplace      = "replace"
+	OperationDelete       = "delete"
+	OperationInvalidate   = "invalidate"
+	OperationDrop         = "drop"
+	OperationRename       = "rename"
+	OperationDropDatabase = "dropDatabase"
+)
+
+// InsertEvent is the typed view of an insert event.
+type InsertEvent[T any, K any] struct {
+	Key      K
+	Document T
+	Event    StreamEvent[T, K]
+}
+
+// UpdateEvent is the typed view of an update event.
+// Document is set only if the stream was opened with a fullDocument option,
+// Before only if the collection has pre-images enabled.
+type UpdateEvent[T any, K any] struct {
+	Key         K
+	Description UpdateDescription
+	Document    T
+	Before      *T
+	Event       StreamEvent[T, K]
+}
+
+// ReplaceEvent is the typed view of a replace event.
+type ReplaceEvent[T any, K any] struct {
+	Key      K
+	Document T
+	Before   *T
+	Event    StreamEvent[T, K]
+}
+
+// DeleteEvent is the typed view of a delete event.
+type DeleteEvent[T any, K any] struct {
+	Key    K
+	Before *T
+	Event  StreamEvent[T, K]
+}
+
+// InvalidateEvent is the typed view of an invalidate event, the stream is closed after it.
+type InvalidateEvent[T any, K any] struct {
+	Event StreamEvent[T, K]
+}
+
+// DropEvent is the typed view of a drop event.
+type DropEvent[T any, K any] struct {
+	Namespace Namespace
+	Event     StreamEvent[T, K]
+}
+
+// RenameEvent is the typed view of a rename event.
+type RenameEvent[T any, K any] struct {
+	From  Namespace
+	To    Namespace
+	Event StreamEvent[T, K]
+}
+
+// DropDatabaseEvent is the typed view of a dropDatabase event.
+type DropDatabaseEvent[T any, K any] struct {
+	Database string
+	Event    StreamEvent[T, K]
+}
+
+func (s StreamEvent[T, K]) AsInsert() (InsertEvent[T, K], bool) {
+	if s.OperationType != OperationInsert {
+		return InsertEvent[T, K]{}, false
+	}
+	return InsertEvent[T, K]{Key: s.DocumentKey.ID, Document: s.FullDocument, Event: s}, true
+}
+
+func (s StreamEvent[T, K]) AsUpdate() (UpdateEvent[T, K], bool) {
+	if s.OperationType != OperationUpdate {
+		return UpdateEvent[T, K]{}, false
+	}
+	e := UpdateEvent[T, K]{Key: s.DocumentKey.ID, Document: s.FullDocument, Before: s.FullDocumentBeforeChange, Event: s}
+	if s.UpdateDescription != nil {
+		e.Description = *s.UpdateDescription
+	}
+	return e, true
+}
+
+func (s StreamEvent[T, K]) AsReplace() (ReplaceEvent[T, K], bool) {
+	if s.OperationType != OperationReplace {
+		return ReplaceEvent[T, K]{}, false
+	}
+	return ReplaceEvent[T, K]{Key: s.DocumentKey.ID, Document: s.FullDocument, Before: s.FullDocumentBeforeChange, Event: s}, true
+}
+
+func (s StreamEvent[T, K]) AsDelete() (DeleteEvent[T, K], bool) {
+	if s.OperationType != OperationDelete {
+		return DeleteEvent[T, K]{}, false
+	}
+	return DeleteEvent[T, K]{Key: s.DocumentKey.ID, Before: s.FullDocumentBeforeChange, Event: s}, true
+}
+
+func (s StreamEvent[T, K]) AsInvalidate() (InvalidateEvent[T, K], bool) {
+	if s.OperationType != OperationInvalidate {
+		return InvalidateEvent[T, K]{}, false
+	}
+	return InvalidateEvent[T, K]{Event: s}, true
+}
+
+func (s StreamEvent[T, K]) AsDrop() (DropEvent[T, K], bool) {
+	if s.OperationType != OperationDrop {
+		return DropEvent[T, K]{}, false
+	}
+	return DropEvent[T, K]{Namespace: Namespace(s.NS), Event: s}, true
+}
+
+func (s StreamEvent[T, K]) AsRename() (RenameEvent[T, K], bool) {
+	if s.OperationType != OperationRename {
+		return RenameEvent[T, K]{}, false
+	}
+	e := RenameEvent[T, K]{From: Namespace(s.NS), Event: s}
+	if s.To != nil {
+		e.To = *s.To
+	}
+	return e, true
+}
+
+func (s StreamEvent[T, K]) AsDropDatabase() (DropDatabaseEvent[T, K], bool) {
+	if s.OperationType != OperationDropDatabase {
+		return DropDatabaseEvent[T, K]{}, false
+	}
+	return DropDatabaseEvent[T, K]{Database: s.NS.DB, Event: s}, true
+}
+
+// OperationRouter dispatches events to handlers registered by operation type.
+// Events of operation types without a handler are ignored.
+type OperationRouter[T any, K any] struct {
+	handlers map[string]HandlerFn[T, K]
+}
+
+func NewOperationRouter[T any, K any]() *OperationRouter[T, K] {
+	return &OperationRouter[T, K]{
+		handlers: make(map[string]HandlerFn[T, K]),
+	}
+}
+
+func (r *OperationRouter[T, K]) OnInsert(fn func(ctx context.Context, event InsertEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationInsert] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsInsert()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnUpdate(fn func(ctx context.Context, event UpdateEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationUpdate] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsUpdate()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnReplace(fn func(ctx context.Context, event ReplaceEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationReplace] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsReplace()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnDelete(fn func(ctx context.Context, event DeleteEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationDelete] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsDelete()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnInvalidate(fn func(ctx context.Context, event InvalidateEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationInvalidate] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsInvalidate()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnDrop(fn func(ctx context.Context, event DropEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationDrop] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsDrop()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnRename(fn func(ctx context.Context, event RenameEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationRename] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsRename()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+func (r *OperationRouter[T, K]) OnDropDatabase(fn func(ctx context.Context, event DropDatabaseEvent[T, K]) error) *OperationRouter[T, K] {
+	r.handlers[OperationDropDatabase] = func(ctx context.Context, event StreamEvent[T, K]) error {
+		e, _ := event.AsDropDatabase()
+		return fn(ctx, e)
+	}
+	return r
+}
+
+// Operations returns the sorted operation types with a registered handler.
+func (r *OperationRouter[T, K]) Operations() []string {
+	ops := make([]string, 0, len(r.handlers))
+	for op := range r.handlers {
+		ops = append(ops, op)
+	}
+	slices.Sort(ops)
+	return ops
+}
+
+// Match returns the $match stage selecting the routed operation types on the server.
+// Invalidating events are always selected, so that the consumer knows why and when the stream is closed.
+func (r *OperationRouter[T, K]) Match() bson.D {
+	ops := r.Operations()
+	for _, op := range []string{OperationDrop, OperationRename, OperationDropDatabase, OperationInvalidate} {
+		if !slices.Contains(ops, op) {
+			ops = append(ops, op)
+		}
+	}
+	values := make([]any, len(ops))
+	for i, op := range ops {
+		values[i] = op
+	}
+	return query.NewPipelineBuilder().
+		Match(query.FieldIn("operationType", values...)).
+		Build()[0]
+}
+
+// Configure prepends the Match stage to conf.StreamAgg. It must be called before NewStreamConsumer,
+// which copies conf, or use NewConsumer.
+func (r *OperationRouter[T, K]) Configure(conf *Config) {
+	conf.StreamAgg = append([]bson.D{r.Match()}, conf.StreamAgg...)
+}
+
+// NewConsumer returns a Consumer created from conf with the Match stage prepended to its StreamAgg,
+// conf is not modified. Pass Handler to the consumer.
+func (r *OperationRouter[T, K]) NewConsumer(client *mongo.Client, conf *Config) *Consumer[T, K] {
+	routed := *conf
+	r.Configure(&routed)
+	return NewStreamConsumer[T, K](client, &routed)
+}
+
+// Handler returns the HandlerFn to pass to the consumer.
+func (r *OperationRouter[T, K]) Handler() HandlerFn[T, K] {
+	return func(ctx context.Context, event StreamEvent[T, K]) error {
+		if handler, ok := r.handlers[event.OperationType]; ok {
+			return handler(ctx, event)
+		}
+		return nil
+	}
+}
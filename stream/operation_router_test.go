@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestOperationRouter(t *testing.T) {
+	var got []string
+	router := NewOperationRouter[testUser, string]().
+		OnInsert(func(ctx context.Context, event InsertEvent[testUser, string]) error {
+			got = append(got, "insert:"+event.Key+":"+event.Document.Name)
+			return nil
+		}).
+		OnUpdate(func(ctx context.Context, event UpdateEvent[testUser, string]) error {
+			got = append(got, "update:"+event.Key+":"+event.Description.RemovedFields[0])
+			return nil
+		}).
+		OnRename(func(ctx context.Context, event RenameEvent[testUser, string]) error {
+			got = append(got, "rename:"+event.From.Coll+":"+event.To.Coll)
+			return nil
+		})
+	handler := router.Handler()
+
+	insert := StreamEvent[testUser, string]{OperationType: OperationInsert, FullDocument: testUser{Name: "john"}}
+	insert.DocumentKey.ID = "1"
+	update := StreamEvent[testUser, string]{OperationType: OperationUpdate, UpdateDescription: &UpdateDescription{RemovedFields: []string{"name"}}}
+	update.DocumentKey.ID = "1"
+	rename := StreamEvent[testUser, string]{OperationType: OperationRename, To: &Namespace{DB: "db", Coll: "new"}}
+	rename.NS.Coll = "old"
+	del := StreamEvent[testUser, string]{OperationType: OperationDelete}
+
+	for _, event := range []StreamEvent[testUser, string]{insert, update, rename, del} {
+		if err := handler(context.Background(), event); err != nil {
+			t.Fatalf("handler() error = %v", err)
+		}
+	}
+	want := []string{"insert:1:john", "update:1:name", "rename:old:new"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("handler() dispatched %v, want %v", got, want)
+	}
+}
+
+func TestOperationRouter_Match(t *testing.T) {
+	router := NewOperationRouter[testUser, string]().
+		OnUpdate(func(ctx context.Context, event UpdateEvent[testUser, string]) error { return nil }).
+		OnDelete(func(ctx context.Context, event DeleteEvent[testUser, string]) error { return nil })
+
+	want := bson.D{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"delete", "update", "drop", "rename", "dropDatabase", "invalidate"}}}}}}}
+	if got := router.Match(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() = %v, want %v", got, want)
+	}
+
+	project := bson.D{{Key: "$project", Value: bson.D{{Key: "fullDocument", Value: 1}}}}
+	conf := &Config{StreamAgg: []bson.D{project}}
+	router.Configure(conf)
+	if len(conf.StreamAgg) != 2 || !reflect.DeepEqual(conf.StreamAgg[0], want) || !reflect.DeepEqual(conf.StreamAgg[1], project) {
+		t.Errorf("Configure() StreamAgg = %v", conf.StreamAgg)
+	}
+
+	conf = &Config{StreamAgg: []bson.D{project}}
+	c := router.NewConsumer(nil, conf)
+	if len(c.streamAggregation) != 2 || !reflect.DeepEqual(c.streamAggregation[0], want) || len(conf.StreamAgg) != 1 {
+		t.Errorf("NewConsumer() StreamAgg = %v, config StreamAgg = %v", c.streamAggregation, conf.StreamAgg)
+	}
+}
+
+func TestStreamEvent_typedViews(t *testing.T) {
+	event := StreamEvent[testUser, string]{OperationType: OperationDelete}
+	if _, ok := event.AsInsert(); ok {
+		t.Errorf("AsInsert() accepted a delete event")
+	}
+	if _, ok := event.AsDelete(); !ok {
+		t.Errorf("AsDelete() rejected a delete event")
+	}
+	event = StreamEvent[testUser, string]{OperationType: OperationDropDatabase}
+	event.NS.DB = "app"
+	if e, ok := event.AsDropDatabase(); !ok || e.Database != "app" {
+		t.Errorf("AsDropDatabase() = %+v, %v", e, ok)
+	}
+}
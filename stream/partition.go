@@ -0,0 +1,258 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// PartitionMatch returns a $match stage selecting the events of partition, out of partitions,
+// by hashing documentKey._id. Events without a document key, such as invalidate, are matched by every partition.
+func PartitionMatch(partition, partitions int) bson.D {
+	hash := bson.D{{Key: "$abs", Value: bson.D{{Key: "$toHashedIndexKey", Value: "$documentKey._id"}}}}
+	mod := bson.D{{Key: "$mod", Value: bson.A{hash, int64(partitions)}}}
+	return bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+		query.NewFilterBuilder().NotExists("documentKey").Build(),
+		bson.D{{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{mod, int64(partition)}}}}},
+	}}}}}
+}
+
+// PartitionKey returns the key of partition of the consumer group name, used for leases.
+func PartitionKey(name string, partition int) string {
+	return fmt.Sprintf("%s/%d", name, partition)
+}
+
+// PartitionOffsetKey returns the key of the offsets of partition of the consumer group name.
+func PartitionOffsetKey(name string, partition int) string {
+	return PartitionKey(name+"/offsets", partition)
+}
+
+// GroupCollection is the subset of *mongo.Collection used by ConsumerGroup.
+type GroupCollection interface {
+	OffsetCollection
+	Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
+}
+
+// GroupConfig configures a ConsumerGroup.
+type GroupConfig struct {
+	// Group is the name of the group, instances consuming the same stream must use the same name.
+	Group string
+	// Member identifies the instance, it must be unique in the group.
+	Member string
+	// Partitions is the number of partitions the stream is split into, it must be the same for every member.
+	Partitions int
+	// HeartbeatInterval is how often membership is refreshed and partitions rebalanced, default 5s.
+	HeartbeatInterval time.Duration
+	// SessionTimeout is the time after which a member which stopped sending heartbeats
+	// is removed from the group, default 3 heartbeats. It is also the TTL of partition leases.
+	SessionTimeout time.Duration
+	// Offsets returns the OffsetManager of partition, it should be fenced by lease. By default offsets are
+	// stored in the group collection by NewMongoOffsetManager(collection, PartitionOffsetKey(group, partition), true)
+	// fenced by lease.
+	Offsets func(partition int, lease *Lease) OffsetManager
+	// OnRebalance, if set, is called with the partitions assigned to the member when they change.
+	OnRebalance func(ctx context.Context, partitions []int)
+}
+
+// ConsumerGroup splits a change stream across the instances of a group, Kafka style: the stream is divided
+// into a fixed number of partitions by document key and each partition is consumed by a single member at a time.
+// Members and partition leases are stored in a MongoDB collection.
+type ConsumerGroup[T any, K any] struct {
+	client     *mongo.Client
+	conf       Config
+	collection GroupCollection
+
+	group             string
+	member            string
+	partitions        int
+	heartbeatInterval time.Duration
+	sessionTimeout    time.Duration
+	offsets           func(partition int, lease *Lease) OffsetManager
+	onRebalance       func(ctx context.Context, partitions []int)
+}
+
+// memberDocument is the heartbeat of a group member.
+type memberDocument struct {
+	ID          string    `bson:"_id"`
+	Group       string    `bson:"group"`
+	Member      string    `bson:"member"`
+	HeartbeatAt time.Time `bson:"heartbeatAt"`
+}
+
+// NewConsumerGroup returns a ConsumerGroup whose partition consumers are created from conf,
+// conf.TokenManager and conf.Lease are replaced by the ones of each partition.
+func NewConsumerGroup[T any, K any](client *mongo.Client, conf *Config, collection GroupCollection, groupConf GroupConfig) (*ConsumerGroup[T, K], error) {
+	if groupConf.Partitions <= 0 {
+		return nil, fmt.Errorf("invalid number of partitions: %d", groupConf.Partitions)
+	}
+	offsets := groupConf.Offsets
+	if offsets == nil {
+		offsets = func(partition int, lease *Lease) OffsetManager {
+			return NewMongoOffsetManager(collection, PartitionOffsetKey(groupConf.Group, partition), true).WithLease(lease)
+		}
+	}
+	heartbeatInterval := groupConf.HeartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = 5 * time.Second
+	}
+	sessionTimeout := groupConf.SessionTimeout
+	if sessionTimeout <= 0 {
+		sessionTimeout = 3 * heartbeatInterval
+	}
+	return &ConsumerGroup[T, K]{
+		client:            client,
+		conf:              *conf,
+		collection:        collection,
+		group:             groupConf.Group,
+		member:            groupConf.Member,
+		partitions:        groupConf.Partitions,
+		heartbeatInterval: heartbeatInterval,
+		sessionTimeout:    sessionTimeout,
+		offsets:           offsets,
+		onRebalance:       groupConf.OnRebalance,
+	}, nil
+}
+
+// ConsumeHandler joins the group and calls handler for the events of the partitions assigned to the member,
+// until ctx is done or a partition consumer fails. Partitions are rebalanced when members join or leave.
+func (g *ConsumerGroup[T, K]) ConsumeHandler(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	running := map[int]context.CancelFunc{}
+	errs := make(chan error, g.partitions)
+	defer func() {
+		cancel()
+		wg.Wait()
+		g.leave(context.WithoutCancel(ctx))
+	}()
+
+	ticker := time.NewTicker(g.heartbeatInterval)
+	defer ticker.Stop()
+	var assigned []int
+	for {
+		members, err := g.heartbeat(ctx)
+		// on errors the current assignment is kept, partition leases prevent double consumption
+		if err == nil {
+			if next := assignPartitions(members, g.partitions, g.member); !slices.Equal(next, assigned) {
+				assigned = next
+				for partition, stop := range running {
+					if !slices.Contains(assigned, partition) {
+						stop()
+						delete(running, partition)
+					}
+				}
+				for _, partition := range assigned {
+					if _, ok := running[partition]; ok {
+						continue
+					}
+					partitionCtx, stop := context.WithCancel(ctx)
+					running[partition] = stop
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						err := g.consumer(partition).ConsumeHandler(partitionCtx, streamOptions, handler)
+						if err != nil && partitionCtx.Err() == nil {
+							errs <- fmt.Errorf("partition %d: %w", partition, err)
+						}
+					}()
+				}
+				if g.onRebalance != nil {
+					g.onRebalance(ctx, slices.Clone(assigned))
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// consumer returns the Consumer of partition.
+func (g *ConsumerGroup[T, K]) consumer(partition int) *Consumer[T, K] {
+	key := PartitionKey(g.group, partition)
+	lease := NewLease(g.collection, LeaseConfig{
+		Name:          key,
+		Owner:         g.member,
+		TTL:           g.sessionTimeout,
+		RenewInterval: g.heartbeatInterval,
+	})
+	conf := g.conf
+	conf.StreamAgg = append([]bson.D{PartitionMatch(partition, g.partitions)}, g.conf.StreamAgg...)
+	conf.Lease = lease
+	conf.TokenManager = g.offsets(partition, lease)
+	return NewStreamConsumer[T, K](g.client, &conf)
+}
+
+// heartbeat refreshes the member heartbeat and returns the live members of the group.
+func (g *ConsumerGroup[T, K]) heartbeat(ctx context.Context) ([]string, error) {
+	now := time.Now()
+	filter := query.NewFilterBuilder().Eq("_id", g.memberID()).Build()
+	update := query.NewUpdateBuilder().
+		Set("group", g.group).
+		Set("member", g.member).
+		Set("heartbeatAt", now).
+		Build()
+	if _, err := g.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true)); err != nil {
+		return nil, err
+	}
+
+	filter = query.NewFilterBuilder().
+		Eq("group", g.group).
+		Gt("heartbeatAt", now.Add(-g.sessionTimeout)).
+		Build()
+	cursor, err := g.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var docs []memberDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	members := make([]string, len(docs))
+	for i, doc := range docs {
+		members[i] = doc.Member
+	}
+	return members, nil
+}
+
+// leave removes the member from the group, so that its partitions are rebalanced without waiting for the session timeout.
+func (g *ConsumerGroup[T, K]) leave(ctx context.Context) error {
+	filter := query.NewFilterBuilder().Eq("_id", g.memberID()).Build()
+	update := query.NewUpdateBuilder().Set("heartbeatAt", time.Time{}).Build()
+	_, err := g.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (g *ConsumerGroup[T, K]) memberID() string {
+	return g.group + "/members/" + g.member
+}
+
+// assignPartitions returns the partitions assigned to member: partitions are spread round robin
+// over members sorted by name, so that every member computes the same assignment.
+func assignPartitions(members []string, partitions int, member string) []int {
+	members = slices.Clone(members)
+	slices.Sort(members)
+	members = slices.Compact(members)
+	i := slices.Index(members, member)
+	if i < 0 {
+		return nil
+	}
+	var assigned []int
+	for partition := i; partition < partitions; partition += len(members) {
+		assigned = append(assigned, partition)
+	}
+	return assigned
+}
@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestAssignPartitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		members    []string
+		partitions int
+		member     string
+		want       []int
+	}{
+		{name: "single member", members: []string{"a"}, partitions: 3, member: "a", want: []int{0, 1, 2}},
+		{name: "round robin", members: []string{"c", "a", "b"}, partitions: 5, member: "b", want: []int{1, 4}},
+		{name: "more members than partitions", members: []string{"a", "b", "c"}, partitions: 2, member: "c", want: nil},
+		{name: "not a member", members: []string{"a"}, partitions: 2, member: "b", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := assignPartitions(tt.members, tt.partitions, tt.member); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assignPartitions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionMatch(t *testing.T) {
+	stage := PartitionMatch(2, 8)
+	b, err := bson.MarshalExtJSON(stage, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$match":{"$or":[{"documentKey":{"$exists":false}},{"$expr":{"$eq":[{"$mod":[{"$abs":{"$toHashedIndexKey":"$documentKey._id"}},8]},2]}}]}}`
+	if string(b) != want {
+		t.Errorf("PartitionMatch() = %s, want %s", b, want)
+	}
+}
+
+func TestConsumerGroup_heartbeat(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	member := func(name string) *ConsumerGroup[any, any] {
+		g, err := NewConsumerGroup[any, any](nil, &Config{}, coll, GroupConfig{
+			Group:             "orders",
+			Member:            name,
+			Partitions:        4,
+			HeartbeatInterval: time.Millisecond,
+			SessionTimeout:    time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("NewConsumerGroup() error = %v", err)
+		}
+		return g
+	}
+	a, b := member("a"), member("b")
+	if _, err := a.heartbeat(ctx); err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	members, err := b.heartbeat(ctx)
+	if err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	slices.Sort(members)
+	if !reflect.DeepEqual(members, []string{"a", "b"}) {
+		t.Errorf("heartbeat() = %v, want [a b]", members)
+	}
+
+	if err := a.leave(ctx); err != nil {
+		t.Fatalf("leave() error = %v", err)
+	}
+	members, _ = b.heartbeat(ctx)
+	if !reflect.DeepEqual(members, []string{"b"}) {
+		t.Errorf("heartbeat() = %v, want [b] after a left", members)
+	}
+
+	c := b.consumer(3)
+	if len(c.streamAggregation) != 1 || c.lease == nil || c.lease.name != "orders/3" {
+		t.Errorf("consumer() = %+v, want partition stage and lease", c)
+	}
+	offsets, ok := c.tokenManager.(*MongoOffsetManager)
+	if !ok || offsets.consumer != "orders/offsets/3" || offsets.lease != c.lease || !offsets.monotonic {
+		t.Errorf("consumer() offsets = %+v, want monotonic partition offsets fenced by the lease", c.tokenManager)
+	}
+}
+
+func TestNewConsumerGroup_partitions(t *testing.T) {
+	_, err := NewConsumerGroup[any, any](nil, &Config{}, newMemoryCollection(), GroupConfig{Group: "orders", Member: "a"})
+	if err == nil {
+		t.Errorf("NewConsumerGroup() error = nil, want error without partitions")
+	}
+}
@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ReconnectPolicy configures how a Consumer reopens its change stream after a transient failure.
+// Stream is always reopened from the last offset committed through OffsetManager.
+type ReconnectPolicy struct {
+	// MaxAttempts is the maximum number of consecutive reconnect attempts, 0 means no limit.
+	// Counter is reset as soon as an event is processed successfully.
+	MaxAttempts int
+	Backoff     Backoff
+}
+
+// Backoff describes an exponential backoff with optional jitter.
+// Zero values are replaced with sensible defaults.
+type Backoff struct {
+	Initial    time.Duration // default 1s
+	Max        time.Duration // default 30s
+	Multiplier float64       // default 2
+	Jitter     float64       // fraction of the delay randomly added or removed, in [0, 1]
+}
+
+// Duration returns the delay to wait before given attempt, attempts start from 1.
+func (b Backoff) Duration(attempt int) time.Duration {
+	initial, maxDelay, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	if maxDelay < initial {
+		maxDelay = initial
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if b.Jitter > 0 {
+		jitter := math.Min(b.Jitter, 1)
+		d += d * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// sleepContext waits for d or until ctx is done, whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// resumableCodes are server error codes after which a change stream can be safely reopened,
+// see the change streams specification.
+var resumableCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	43,    // CursorNotFound
+	63,    // StaleShardVersion
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	133,   // FailedToSatisfyReadPreference
+	150,   // StaleEpoch
+	189,   // PrimarySteppedDown
+	234,   // RetryChangeStream
+	262,   // ExceededTimeLimit
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13388, // StaleConfig
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// IsResumableError returns true if err represents a transient failure after which
+// the change stream can be reopened from the last committed offset.
+func IsResumableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		if se.HasErrorLabel("ResumableChangeStreamError") {
+			return true
+		}
+		for _, code := range resumableCodes {
+			if se.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamRun runs a change stream opened from start until it ends,
+// progressed reports whether at least one event was processed.
+type streamRun func(ctx context.Context, start *streamStart) (progressed bool, err error)
+
+// supervise calls run until it returns a non resumable error or reconnect attempts are exhausted.
+func (c *Consumer[T, K]) supervise(ctx context.Context, start *streamStart, run streamRun) error {
+	attempt := 0
+	for {
+		progressed, err := run(ctx, start)
+		if err == nil || !IsResumableError(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if progressed {
+			attempt = 0
+		}
+		attempt++
+		if c.reconnect.MaxAttempts > 0 && attempt > c.reconnect.MaxAttempts {
+			return err
+		}
+		c.meter().Reconnected(attempt, err)
+		if err := sleepContext(ctx, c.reconnect.Backoff.Duration(attempt)); err != nil {
+			return err
+		}
+	}
+}
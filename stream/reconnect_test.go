@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestBackoff_Duration(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "zero value uses defaults",
+			backoff: Backoff{},
+			attempt: 1,
+			want:    time.Second,
+		},
+		{
+			name:    "delay grows exponentially",
+			backoff: Backoff{Initial: 100 * time.Millisecond, Max: time.Minute, Multiplier: 2},
+			attempt: 4,
+			want:    800 * time.Millisecond,
+		},
+		{
+			name:    "delay is capped to max",
+			backoff: Backoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 3},
+			attempt: 10,
+			want:    5 * time.Second,
+		},
+		{
+			name:    "invalid attempt is treated as first",
+			backoff: Backoff{Initial: 10 * time.Millisecond},
+			attempt: 0,
+			want:    10 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Duration(tt.attempt); got != tt.want {
+				t.Errorf("Backoff.Duration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff_DurationJitter(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		got := b.Duration(1)
+		if got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("Backoff.Duration() = %v, out of jitter range", got)
+		}
+	}
+}
+
+func TestIsResumableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil error", nil, false},
+		{"generic error", errors.New("boom"), false},
+		{"context canceled", context.Canceled, false},
+		{"cursor not found", mongo.CommandError{Code: 43}, true},
+		{"primary stepped down", mongo.CommandError{Code: 189}, true},
+		{"not writable primary", mongo.CommandError{Code: 10107}, true},
+		{"network error label", mongo.CommandError{Labels: []string{"NetworkError"}}, true},
+		{"resumable label", mongo.CommandError{Code: 1, Labels: []string{"ResumableChangeStreamError"}}, true},
+		{"history lost", mongo.CommandError{Code: 286}, false},
+		{"wrapped resumable error", fmt.Errorf("wrap: %w", mongo.CommandError{Code: 43}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsResumableError(tt.err); got != tt.want {
+				t.Errorf("IsResumableError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumer_supervise(t *testing.T) {
+	resumable := mongo.CommandError{Code: 43}
+	fatal := errors.New("fatal")
+	tests := []struct {
+		name      string
+		policy    ReconnectPolicy
+		results   []error
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "terminal error is returned immediately",
+			policy:    ReconnectPolicy{MaxAttempts: 3},
+			results:   []error{fatal},
+			wantErr:   fatal,
+			wantCalls: 1,
+		},
+		{
+			name:      "stream is reopened after resumable errors",
+			policy:    ReconnectPolicy{MaxAttempts: 3},
+			results:   []error{resumable, resumable, nil},
+			wantErr:   nil,
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts are capped",
+			policy:    ReconnectPolicy{MaxAttempts: 2},
+			results:   []error{resumable, resumable, resumable, nil},
+			wantErr:   resumable,
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Backoff = Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+			c := &Consumer[any, any]{reconnect: &tt.policy}
+			calls := 0
+			err := c.supervise(context.Background(), nil, func(ctx context.Context, start *streamStart) (bool, error) {
+				err := tt.results[calls]
+				calls++
+				return false, err
+			})
+			if fmt.Sprint(err) != fmt.Sprint(tt.wantErr) {
+				t.Errorf("supervise() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("supervise() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
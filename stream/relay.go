@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// RelayFormat selects how Relay serializes events.
+type RelayFormat int
+
+const (
+	// RelayExtJSON serializes events as relaxed Extended JSON, preserving bson types.
+	RelayExtJSON RelayFormat = iota
+	// RelayJSON serializes events with encoding/json.
+	RelayJSON
+)
+
+// Message is an event serialized by Relay.
+type Message struct {
+	// Key is the relaxed Extended JSON of the event document key, e.g. {"_id":1}, useful to partition messages.
+	Key []byte
+	// Value is the serialized event, passed through Config.Encoder when set.
+	Value []byte
+	// Encoded is true if Value was passed through Config.Encoder.
+	Encoded       bool
+	OperationType string
+	Namespace     Namespace
+	Offset        StreamOffset
+}
+
+// Sink receives the messages of Relay, Write must return only once the message is acknowledged,
+// since the event offset is committed right after it.
+type Sink interface {
+	Write(ctx context.Context, msg Message) error
+}
+
+// Relay serializes each event of the change stream, passes it through Config.Encoder and writes it to sink,
+// committing its offset after sink acknowledged it. Failures are handled like handler ones.
+// T and K must be serializable when missing from the event, e.g. use bson.M rather than bson.Raw.
+func (c *Consumer[T, K]) Relay(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, sink Sink, format RelayFormat) error {
+	return c.ConsumeHandler(ctx, streamOptions, func(ctx context.Context, event StreamEvent[T, K]) error {
+		msg, err := c.message(event, format)
+		if err != nil {
+			return err
+		}
+		return sink.Write(ctx, msg)
+	})
+}
+
+// message serializes event.
+func (c *Consumer[T, K]) message(event StreamEvent[T, K], format RelayFormat) (Message, error) {
+	key, err := bson.MarshalExtJSON(event.DocumentKey, false, false)
+	if err != nil {
+		return Message{}, err
+	}
+	var value []byte
+	switch format {
+	case RelayExtJSON:
+		value, err = bson.MarshalExtJSON(event, false, false)
+	case RelayJSON:
+		value, err = json.Marshal(event)
+	default:
+		err = fmt.Errorf("unknown relay format %d", format)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{
+		Key:           key,
+		Value:         value,
+		OperationType: event.OperationType,
+		Namespace:     Namespace(event.NS),
+		Offset:        *event.GetStreamOffset(),
+	}
+	if c.encoder != nil {
+		if msg.Value, err = c.encoder.Encode(value); err != nil {
+			return Message{}, err
+		}
+		msg.Encoded = true
+	}
+	return msg, nil
+}
@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestConsumer_message(t *testing.T) {
+	event := StreamEvent[testUser, int32]{OperationType: OperationInsert, FullDocument: testUser{Name: "john"}}
+	event.ID.Data = "token1"
+	event.DocumentKey.ID = 7
+	event.NS.DB, event.NS.Coll = "app", "users"
+
+	tests := []struct {
+		name    string
+		format  RelayFormat
+		encoder EventEncoder
+		want    string
+	}{
+		{name: "extended json", format: RelayExtJSON, want: `"documentKey":{"_id":7}`},
+		{name: "json", format: RelayJSON, want: `"documentKey":{"_id":7}`},
+		{name: "encoded", format: RelayJSON, encoder: &GzipEncoderDecoder{}, want: `"fullDocument":{"Name":"john"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Consumer[testUser, int32]{encoder: tt.encoder}
+			msg, err := c.message(event, tt.format)
+			if err != nil {
+				t.Fatalf("message() error = %v", err)
+			}
+			value := msg.Value
+			if tt.encoder != nil {
+				if !msg.Encoded {
+					t.Errorf("message() Encoded = false")
+				}
+				if value, err = (&GzipEncoderDecoder{}).Decode(value); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+			}
+			if !strings.Contains(string(value), tt.want) {
+				t.Errorf("message() value = %s, want it to contain %s", value, tt.want)
+			}
+			if string(msg.Key) != `{"_id":7}` || msg.Namespace.Coll != "users" || msg.Offset.ResumeToken != "token1" {
+				t.Errorf("message() = %+v", msg)
+			}
+		})
+	}
+}
+
+func TestConsumer_messageExtJSON(t *testing.T) {
+	event := StreamEvent[bson.M, bson.ObjectID]{OperationType: OperationDelete}
+	event.DocumentKey.ID = bson.NewObjectID()
+	msg, err := (&Consumer[bson.M, bson.ObjectID]{}).message(event, RelayExtJSON)
+	if err != nil {
+		t.Fatalf("message() error = %v", err)
+	}
+	var decoded StreamEvent[bson.M, bson.ObjectID]
+	if err := bson.UnmarshalExtJSON(msg.Value, false, &decoded); err != nil {
+		t.Fatalf("UnmarshalExtJSON() error = %v", err)
+	}
+	if decoded.DocumentKey.ID != event.DocumentKey.ID {
+		t.Errorf("decoded documentKey = %v, want %v", decoded.DocumentKey.ID, event.DocumentKey.ID)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	sink := NewWriterSink(w)
+	ctx := context.Background()
+	if err := sink.Write(ctx, Message{Value: []byte(`{"a":1}`)}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := sink.Write(ctx, Message{Key: []byte(`{"_id":1}`), Value: []byte{0, 1}, Encoded: true}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := `{"a":1}` + "\n" + `{"key":{"_id":1},"value":"` + base64.StdEncoding.EncodeToString([]byte{0, 1}) + `","encoded":true}` + "\n"
+	if buf.String() != want {
+		t.Errorf("written %q, want %q", buf.String(), want)
+	}
+	for _, l := range bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n")) {
+		if !json.Valid(l) {
+			t.Errorf("line %q is not valid JSON", l)
+		}
+	}
+}
+
+func TestRotatingFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink := NewRotatingFileSink(RotatingFileConfig{Dir: dir, Prefix: "users", MaxBytes: 20, MaxAge: time.Minute})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+	defer sink.Close()
+
+	ctx := context.Background()
+	value, _ := json.Marshal(map[string]int{"n": 1}) // 7 bytes plus newline
+	for _, step := range []time.Duration{0, 0, time.Second, 2 * time.Minute} {
+		now = now.Add(step)
+		if err := sink.Write(ctx, Message{Value: value}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "users-*.ndjson"))
+	if len(files) != 3 {
+		t.Fatalf("files = %v, want 3: rotated by size and by age", files)
+	}
+	b, _ := os.ReadFile(files[0])
+	if string(b) != "{\"n\":1}\n{\"n\":1}\n" {
+		t.Errorf("first file = %q", b)
+	}
+}
@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WriterSink writes messages to an io.Writer as newline delimited JSON, one value per line.
+// Encoded values are binary, they are written as {"key":<key>,"value":"<base64 value>","encoded":true}.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a Sink writing to w, if w has a Flush() error method, such as *bufio.Writer,
+// it is flushed after each message.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := line(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	if f, ok := s.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// encodedLine is the NDJSON line of an encoded message.
+type encodedLine struct {
+	Key     json.RawMessage `json:"key,omitempty"`
+	Value   []byte          `json:"value"`
+	Encoded bool            `json:"encoded"`
+}
+
+// line returns the NDJSON line of msg.
+func line(msg Message) ([]byte, error) {
+	value := msg.Value
+	if msg.Encoded {
+		var err error
+		if value, err = json.Marshal(encodedLine{Key: msg.Key, Value: msg.Value, Encoded: true}); err != nil {
+			return nil, err
+		}
+	}
+	b := make([]byte, 0, len(value)+1)
+	b = append(b, value...)
+	return append(b, '\n'), nil
+}
+
+// RotatingFileConfig configures a RotatingFileSink.
+type RotatingFileConfig struct {
+	// Dir is the directory of the files, it must exist.
+	Dir string
+	// Prefix of file names, files are named <prefix>-<UTC time>.ndjson.
+	Prefix string
+	// MaxBytes is the size after which a new file is started, default 64MiB.
+	MaxBytes int64
+	// MaxAge, if set, is the age after which a new file is started.
+	MaxAge time.Duration
+}
+
+// RotatingFileSink writes messages as newline delimited JSON to files rotated by size and age.
+// Each message is synced to disk before being acknowledged.
+type RotatingFileSink struct {
+	dir      string
+	prefix   string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+	now     func() time.Time
+}
+
+func NewRotatingFileSink(conf RotatingFileConfig) *RotatingFileSink {
+	maxBytes := conf.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &RotatingFileSink{
+		dir:      conf.Dir,
+		prefix:   conf.Prefix,
+		maxBytes: maxBytes,
+		maxAge:   conf.MaxAge,
+		now:      time.Now,
+	}
+}
+
+func (s *RotatingFileSink) Write(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := line(msg)
+	if err != nil {
+		return err
+	}
+	if err := s.rotate(int64(len(b))); err != nil {
+		return err
+	}
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// rotate starts a new file if the current one cannot take n more bytes or is too old.
+func (s *RotatingFileSink) rotate(n int64) error {
+	now := s.now()
+	if s.file != nil {
+		full := s.size > 0 && s.size+n > s.maxBytes
+		old := s.maxAge > 0 && now.Sub(s.created) >= s.maxAge
+		if !full && !old {
+			return nil
+		}
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+	}
+	name := fmt.Sprintf("%s-%s.ndjson", s.prefix, now.UTC().Format("20060102T150405.000000000"))
+	file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file, s.size, s.created = file, 0, now
+	return nil
+}
+
+// Close closes the current file.
+func (s *RotatingFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
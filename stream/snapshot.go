@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/YoungAgency/mongo-wrapper/v2/query"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// OperationSnapshot is the operation type of the synthetic events delivered while scanning the collection.
+const OperationSnapshot = "snapshot"
+
+// SnapshotOffset is the progress of an initial snapshot, stored in StreamOffset.
+type SnapshotOffset struct {
+	// LastID is the canonical extended JSON of {_id: <value>} of the last handled document,
+	// empty if no document was handled yet.
+	LastID string `json:"lastId" bson:"lastId"`
+}
+
+// ConsumeWithSnapshot scans the collection in _id order calling handler with OperationSnapshot events,
+// then handles the change stream like ConsumeHandler starting from the cluster time recorded before the scan,
+// so that no change is missed. Changes made during the scan may be delivered twice: as snapshot and as stream event.
+// Scan progress is committed through OffsetManager, so that a restarted consumer resumes the scan.
+// If the stored offset already points to the change stream the scan is skipped.
+// With Config.Lease the scan is run, and its progress committed, only while the lease is held.
+// Snapshot is supported only when Config.Collection is set.
+func (c *Consumer[T, K]) ConsumeWithSnapshot(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) error {
+	if c.collection == "" {
+		return errors.New("snapshot requires a collection")
+	}
+	if c.lease != nil {
+		return c.lease.Run(ctx, func(ctx context.Context) error {
+			return c.consumeWithSnapshot(ctx, streamOptions, handler)
+		})
+	}
+	return c.consumeWithSnapshot(ctx, streamOptions, handler)
+}
+
+// consumeWithSnapshot completes the snapshot and then handles the change stream,
+// with Config.Lease it is called only while the lease is held.
+func (c *Consumer[T, K]) consumeWithSnapshot(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) error {
+	if err := c.snapshot(ctx, handler); err != nil {
+		return err
+	}
+	return c.runStream(ctx, func(ctx context.Context, start *streamStart) (bool, error) {
+		return c.consumeHandler(ctx, ctx, start, streamOptions, handler)
+	})
+}
+
+// snapshot scans the collection unless the stored offset already points to the change stream,
+// then commits the cluster time recorded before the scan.
+func (c *Consumer[T, K]) snapshot(ctx context.Context, handler HandlerFn[T, K]) error {
+	offset, err := c.tokenManager.GetOffset(ctx)
+	if err != nil {
+		return err
+	}
+	if offset == nil || (offset.ResumeToken == "" && offset.ClusterTime.IsZero() && offset.Timestamp.IsZero()) {
+		startAt, err := c.operationTime(ctx)
+		if err != nil {
+			return err
+		}
+		offset = &StreamOffset{ClusterTime: startAt, Snapshot: &SnapshotOffset{}}
+		if err := c.commitOffset(ctx, *offset); err != nil {
+			return err
+		}
+	}
+	if offset.Snapshot == nil || offset.ResumeToken != "" {
+		return nil
+	}
+	if err := c.scan(ctx, *offset, handler); err != nil {
+		return err
+	}
+	return c.commitOffset(ctx, StreamOffset{ClusterTime: offset.ClusterTime})
+}
+
+// operationTime returns the current cluster time.
+func (c *Consumer[T, K]) operationTime(ctx context.Context) (bson.Timestamp, error) {
+	sess, err := c.client.StartSession()
+	if err != nil {
+		return bson.Timestamp{}, err
+	}
+	defer sess.EndSession(ctx)
+	cmd := bson.D{{Key: "ping", Value: 1}}
+	if err := c.client.Database(c.database).RunCommand(mongo.NewSessionContext(ctx, sess), cmd).Err(); err != nil {
+		return bson.Timestamp{}, err
+	}
+	t := sess.OperationTime()
+	if t == nil {
+		return bson.Timestamp{}, errors.New("server did not return an operation time, change streams need a replica set")
+	}
+	return *t, nil
+}
+
+// scan handles the documents with _id greater than offset.Snapshot.LastID, committing progress after each one.
+func (c *Consumer[T, K]) scan(ctx context.Context, offset StreamOffset, handler HandlerFn[T, K]) error {
+	filter := query.NewFilterBuilder()
+	if offset.Snapshot.LastID != "" {
+		lastID, err := decodeLastID(offset.Snapshot.LastID)
+		if err != nil {
+			return err
+		}
+		filter.Gt("_id", lastID)
+	}
+	coll := c.client.Database(c.database).Collection(c.collection)
+	cursor, err := coll.Find(ctx, filter.Build(), query.NewFindOptions().AscSort("_id").Options())
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.WithoutCancel(ctx))
+
+	for cursor.Next(ctx) {
+		event, err := c.snapshotEvent(cursor.Current, offset.ClusterTime)
+		if err != nil {
+			return err
+		}
+		if err := c.callHandler(ctx, cursor.Current, event, handler); err != nil {
+			return err
+		}
+		lastID, err := encodeLastID(cursor.Current.Lookup("_id"))
+		if err != nil {
+			return err
+		}
+		progress := StreamOffset{ClusterTime: offset.ClusterTime, Snapshot: &SnapshotOffset{LastID: lastID}}
+		if err := c.commitOffset(ctx, progress); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// snapshotEvent builds the synthetic event of a scanned document.
+func (c *Consumer[T, K]) snapshotEvent(doc bson.Raw, startAt bson.Timestamp) (StreamEvent[T, K], error) {
+	event := StreamEvent[T, K]{OperationType: OperationSnapshot}
+	if err := bson.Unmarshal(doc, &event.FullDocument); err != nil {
+		return event, err
+	}
+	if err := doc.Lookup("_id").Unmarshal(&event.DocumentKey.ID); err != nil {
+		return event, fmt.Errorf("cannot decode document _id: %w", err)
+	}
+	event.NS.DB, event.NS.Coll = c.database, c.collection
+	event.ClusterTimestamp = startAt
+	return event, nil
+}
+
+// encodeLastID encodes id as the canonical extended JSON of {_id: id}, preserving its bson type.
+func encodeLastID(id bson.RawValue) (string, error) {
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: id}}, true, false)
+	return string(b), err
+}
+
+// decodeLastID decodes a value encoded by encodeLastID.
+func decodeLastID(s string) (bson.RawValue, error) {
+	var doc bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(s), true, &doc); err != nil {
+		return bson.RawValue{}, err
+	}
+	return doc.LookupErr("_id")
+}
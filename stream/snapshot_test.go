@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestLastID(t *testing.T) {
+	oid := bson.NewObjectID()
+	tests := []struct {
+		name string
+		id   any
+	}{
+		{name: "object id", id: oid},
+		{name: "int32", id: int32(7)},
+		{name: "int64", id: int64(7)},
+		{name: "string", id: "user-1"},
+		{name: "document", id: bson.D{{Key: "tenant", Value: "a"}, {Key: "n", Value: int32(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := bson.Marshal(bson.D{{Key: "_id", Value: tt.id}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := bson.Raw(doc).Lookup("_id")
+			s, err := encodeLastID(want)
+			if err != nil {
+				t.Fatalf("encodeLastID() error = %v", err)
+			}
+			got, err := decodeLastID(s)
+			if err != nil {
+				t.Fatalf("decodeLastID(%s) error = %v", s, err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("decodeLastID(%s) = %v, want %v", s, got, want)
+			}
+		})
+	}
+}
+
+func TestConsumer_snapshotEvent(t *testing.T) {
+	c := &Consumer[testUser, int32]{database: "app", collection: "users"}
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: int32(3)}, {Key: "name", Value: "john"}})
+	startAt := bson.Timestamp{T: 100, I: 2}
+
+	event, err := c.snapshotEvent(doc, startAt)
+	if err != nil {
+		t.Fatalf("snapshotEvent() error = %v", err)
+	}
+	if event.OperationType != OperationSnapshot || event.DocumentKey.ID != 3 || event.FullDocument.Name != "john" {
+		t.Errorf("snapshotEvent() = %+v", event)
+	}
+	if event.NS.DB != "app" || event.NS.Coll != "users" || event.GetStreamOffset().ClusterTime != startAt {
+		t.Errorf("snapshotEvent() = %+v, want namespace and start time", event)
+	}
+}
+
+func TestMongoOffsetManager_snapshot(t *testing.T) {
+	ctx := context.Background()
+	m := NewMongoOffsetManager(newMemoryCollection(), "consumer", true)
+	startAt := bson.Timestamp{T: 100, I: 1}
+
+	progress := StreamOffset{ClusterTime: startAt, Snapshot: &SnapshotOffset{LastID: `{"_id":{"$numberInt":"3"}}`}}
+	if err := m.SetOffset(ctx, progress); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	got, _ := m.GetOffset(ctx)
+	if !reflect.DeepEqual(got.Snapshot, progress.Snapshot) {
+		t.Errorf("GetOffset() = %+v, want snapshot progress", got.Snapshot)
+	}
+
+	if err := m.SetOffset(ctx, StreamOffset{ClusterTime: startAt}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	got, _ = m.GetOffset(ctx)
+	if got.Snapshot != nil || got.ClusterTime != startAt {
+		t.Errorf("GetOffset() = %+v, want completed snapshot", got)
+	}
+}
+
+// leaseCheckingOffsetManager fails GetOffset, recording whether the lease was held when called.
+type leaseCheckingOffsetManager struct {
+	defaultOffsetManager
+	lease *Lease
+	held  []bool
+}
+
+var errStop = errors.New("stop")
+
+func (m *leaseCheckingOffsetManager) GetOffset(ctx context.Context) (*StreamOffset, error) {
+	_, held := m.lease.FencingToken()
+	m.held = append(m.held, held)
+	return nil, errStop
+}
+
+func TestConsumer_ConsumeWithSnapshot_lease(t *testing.T) {
+	leases := newMemoryCollection()
+	a := NewLease(leases, LeaseConfig{Name: "orders", Owner: "a", TTL: time.Hour, RenewInterval: time.Millisecond})
+	b := NewLease(leases, LeaseConfig{Name: "orders", Owner: "b", TTL: time.Hour})
+	offsets := &leaseCheckingOffsetManager{lease: a}
+	c := &Consumer[any, any]{collection: "orders", tokenManager: offsets, lease: a}
+
+	if ok, err := b.TryAcquire(context.Background()); !ok || err != nil {
+		t.Fatalf("b.TryAcquire() = %v, %v", ok, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.ConsumeWithSnapshot(ctx, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ConsumeWithSnapshot() error = %v, want %v while another owner holds the lease", err, context.DeadlineExceeded)
+	}
+	if len(offsets.held) != 0 {
+		t.Fatalf("offsets read %d times without holding the lease", len(offsets.held))
+	}
+
+	b.Release(context.Background())
+	if err := c.ConsumeWithSnapshot(context.Background(), nil, nil); !errors.Is(err, errStop) {
+		t.Errorf("ConsumeWithSnapshot() error = %v, want %v", err, errStop)
+	}
+	if !reflect.DeepEqual(offsets.held, []bool{true}) {
+		t.Errorf("lease held on GetOffset = %v, want [true]", offsets.held)
+	}
+}
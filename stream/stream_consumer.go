@@ -2,6 +2,9 @@ package stream
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -10,11 +13,37 @@ import (
 )
 
 type Config struct {
-	Database     string
-	Collection   string
+	// Database and Collection select what is watched: when Collection is empty the whole
+	// database is watched, when Database is empty too the whole cluster is watched.
+	// Collection cannot be set without Database.
+	Database   string
+	Collection string
+	// Encoder, if set, encodes the events serialized by Relay, e.g. compressing them.
 	Encoder      EventEncoder
 	TokenManager OffsetManager
 	StreamAgg    []bson.D
+	// Reconnect enables supervised mode: when set, the stream is reopened from the
+	// last committed offset after resumable errors instead of returning them.
+	Reconnect *ReconnectPolicy
+	// Failure configures retries of failing handlers and offset commits,
+	// by default they are retried forever every second.
+	Failure *FailurePolicy
+	// DrainTimeout is the time given to the in-flight handler to complete when Run or Stop
+	// shut the consumer down, default 30s.
+	DrainTimeout time.Duration
+	// InvalidateMode selects what happens when the stream is invalidated, default InvalidateStop.
+	InvalidateMode InvalidateMode
+	// OnInvalidate, if set, is called when the stream is invalidated.
+	OnInvalidate func(ctx context.Context, err *InvalidatedError)
+	// OnOffsetReset, if set, is called when the stored offset could not be used to resume
+	// the stream and was reset, previous is the discarded offset.
+	OnOffsetReset func(ctx context.Context, previous StreamOffset, cause error)
+	// Lease, if set, makes the consumer handle events only while it holds the lease, the stream is
+	// closed as soon as the lease is lost and reopened once it is acquired again.
+	// Use MongoOffsetManager.WithLease to reject offsets committed by a previous holder.
+	Lease *Lease
+	// Metrics, if set, receives lag, throughput, handler and commit measurements.
+	Metrics Metrics
 }
 
 type Consumer[T any, K any] struct {
@@ -24,6 +53,18 @@ type Consumer[T any, K any] struct {
 	database          string
 	collection        string
 	streamAggregation []bson.D
+	reconnect         *ReconnectPolicy
+	failure           FailurePolicy
+	drainTimeout      time.Duration
+	invalidateMode    InvalidateMode
+	onInvalidate      func(ctx context.Context, err *InvalidatedError)
+	onOffsetReset     func(ctx context.Context, previous StreamOffset, cause error)
+	metrics           Metrics
+	lease             *Lease
+
+	mu        sync.Mutex
+	committed *StreamOffset
+	running   *runState
 }
 
 type HandlerFn[T any, K any] func(ctx context.Context, event StreamEvent[T, K]) error
@@ -41,6 +82,14 @@ func NewStreamConsumer[T any, K any](client *mongo.Client, conf *Config) *Consum
 			encoder = conf.Encoder
 		}
 	}
+	failure := defaultFailurePolicy
+	if conf.Failure != nil {
+		failure = *conf.Failure
+	}
+	drainTimeout := conf.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = 30 * time.Second
+	}
 	return &Consumer[T, K]{
 		encoder:           encoder,
 		tokenManager:      tokenManger,
@@ -48,42 +97,139 @@ func NewStreamConsumer[T any, K any](client *mongo.Client, conf *Config) *Consum
 		database:          conf.Database,
 		collection:        conf.Collection,
 		streamAggregation: conf.StreamAgg,
+		reconnect:         conf.Reconnect,
+		failure:           failure,
+		drainTimeout:      drainTimeout,
+		invalidateMode:    conf.InvalidateMode,
+		onInvalidate:      conf.OnInvalidate,
+		onOffsetReset:     conf.OnOffsetReset,
+		metrics:           conf.Metrics,
+		lease:             conf.Lease,
 	}
 }
 
+// ConsumeHandler calls handler for each event of the change stream.
+// If Config.Reconnect is set, stream is reopened after resumable errors, otherwise they are returned.
+// When the stream is invalidated an *InvalidatedError is returned, unless Config.InvalidateMode is InvalidateRestart.
 func (c *Consumer[T, K]) ConsumeHandler(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) error {
-	stream, err := c.getStream(ctx, streamOptions)
+	return c.run(ctx, func(ctx context.Context, start *streamStart) (bool, error) {
+		return c.consumeHandler(ctx, ctx, start, streamOptions, handler)
+	})
+}
+
+// consumeHandler reads events using streamCtx and handles them using ctx,
+// so that reading can be stopped without interrupting the in-flight handler.
+func (c *Consumer[T, K]) consumeHandler(ctx context.Context, streamCtx context.Context, start *streamStart, streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) (bool, error) {
+	return c.consumeEvents(ctx, streamCtx, start, streamOptions, func(ctx context.Context, raw bson.Raw, event StreamEvent[T, K]) error {
+		return c.handleEvent(ctx, raw, event, handler)
+	})
+}
+
+// consumeEvents is like consumeHandler calling handle for each event, which must also commit its offset.
+func (c *Consumer[T, K]) consumeEvents(ctx context.Context, streamCtx context.Context, start *streamStart, streamOptions *options.ChangeStreamOptionsBuilder, handle func(ctx context.Context, raw bson.Raw, event StreamEvent[T, K]) error) (bool, error) {
+	stream, err := c.getStream(streamCtx, start, cloneStreamOptions(streamOptions))
 	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+	return c.readEvents(ctx, streamCtx, changeStream{stream}, handle)
+}
+
+// readEvents calls handle for each event of source until source is closed or streamCtx is done.
+func (c *Consumer[T, K]) readEvents(ctx context.Context, streamCtx context.Context, source eventSource, handle func(ctx context.Context, raw bson.Raw, event StreamEvent[T, K]) error) (bool, error) {
+	progressed := false
+	inv := &invalidation{}
+	for source.Next(streamCtx) {
+		// Next returns the events already fetched without checking streamCtx
+		if err := streamCtx.Err(); err != nil {
+			return progressed, err
+		}
+		doc := StreamEvent[T, K]{}
+		if err := decodeEvent(source, &doc); err != nil {
+			return progressed, err
+		}
+		c.received(doc)
+		inv.observe(doc.OperationType, Namespace(doc.NS), doc.To, doc.GetStreamOffset())
+		if err := handle(ctx, source.Raw(), doc); err != nil {
+			return progressed, err
+		}
+		progressed = true
+	}
+	if err := source.Err(); err != nil {
+		return progressed, err
+	}
+	return progressed, c.invalidated(ctx, inv)
+}
+
+// handleEvent calls handler applying the failure policy, then commits event offset.
+func (c *Consumer[T, K]) handleEvent(ctx context.Context, raw bson.Raw, event StreamEvent[T, K], handler HandlerFn[T, K]) error {
+	if err := c.callHandler(ctx, raw, event, handler); err != nil {
 		return err
 	}
-	defer stream.Close(ctx)
+	return c.commitOffset(ctx, *event.GetStreamOffset())
+}
 
-	doc := StreamEvent[T, K]{}
-	for stream.Next(ctx) {
-		if err := stream.Decode(&doc); err != nil {
-			return err
+// callHandler calls handler applying the failure policy, it returns nil if the offset can be advanced past event.
+func (c *Consumer[T, K]) callHandler(ctx context.Context, raw bson.Raw, event StreamEvent[T, K], handler HandlerFn[T, K]) error {
+	attempts, err := c.failure.retry(ctx, c.measureHandler(event.OperationType, func(ctx context.Context) error {
+		return handler(ctx, event)
+	}))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		for {
-			if err := handler(ctx, doc); err != nil {
-				<-time.After(1 * time.Second)
-				continue
-			}
-			err = c.tokenManager.SetOffset(ctx, StreamOffset{
-				ResumeToken: doc.ID.Data,
-				Timestamp:   doc.ClusterTime,
-			})
-			if err != nil {
-				<-time.After(1 * time.Second)
-				continue
-			}
-			break
+		if errors.Is(err, ErrLeaseLost) {
+			return err
 		}
+		return c.deadLetter(ctx, DeadLetter{
+			Event:         raw,
+			StreamEvent:   event,
+			OperationType: event.OperationType,
+			Offset:        *event.GetStreamOffset(),
+			Attempts:      attempts,
+			Err:           err,
+		})
+	}
+	return nil
+}
+
+// deadLetter handles an event whose attempts are exhausted.
+// It returns nil if the offset can be advanced past the event.
+func (c *Consumer[T, K]) deadLetter(ctx context.Context, letter DeadLetter) error {
+	if c.failure.DeadLetter != nil {
+		return c.failure.DeadLetter.Send(ctx, letter)
+	}
+	if c.failure.Skip {
+		return nil
 	}
-	return stream.Err()
+	return letter.Err
 }
 
-func (c *Consumer[T, K]) getStream(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder) (*mongo.ChangeStream, error) {
-	resumeToken, err := c.tokenManager.GetOffset(ctx)
+// commitOffset saves offset applying the failure policy.
+func (c *Consumer[T, K]) commitOffset(ctx context.Context, offset StreamOffset) error {
+	_, err := c.failure.retry(ctx, func(ctx context.Context) error {
+		start := time.Now()
+		err := c.tokenManager.SetOffset(ctx, offset)
+		c.meter().OffsetCommitted(time.Since(start), err)
+		return err
+	})
+	if err != nil && ctx.Err() == nil && c.failure.Skip && !errors.Is(err, ErrLeaseLost) {
+		// offset will be committed with the next event
+		return nil
+	}
+	if err == nil {
+		c.mu.Lock()
+		c.committed = &offset
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *Consumer[T, K]) getStream(ctx context.Context, start *streamStart, streamOptions *options.ChangeStreamOptionsBuilder) (*mongo.ChangeStream, error) {
+	if c.database == "" && c.collection != "" {
+		return nil, ErrCollectionWithoutDatabase
+	}
+	resumeToken, restarted, err := c.startOffset(ctx, start)
 	if err != nil {
 		return nil, err
 	}
@@ -91,29 +237,93 @@ func (c *Consumer[T, K]) getStream(ctx context.Context, streamOptions *options.C
 		streamOptions.SetStartAfter(bson.M{
 			"_data": resumeToken.ResumeToken,
 		})
-	} else if resumeToken != nil && !resumeToken.Timestamp.IsZero() {
+		streamOptions.SetStartAtOperationTime(nil)
+	} else if resumeToken != nil && (!resumeToken.ClusterTime.IsZero() || !resumeToken.Timestamp.IsZero()) {
 		// if timestamp is out of range for oplog it will be ignored
-		dt := &bson.Timestamp{T: uint32(resumeToken.Timestamp.UTC().Unix()), I: 0}
-		streamOptions.SetStartAtOperationTime(dt)
+		dt := resumeToken.operationTime()
+		streamOptions.SetStartAtOperationTime(&dt)
 	}
-	stream, err := c.client.Database(c.database).
-		Collection(c.collection).
-		Watch(ctx, c.streamAggregation, streamOptions)
-	if err != nil {
-		if mongoErr, ok := err.(mongo.CommandError); ok {
-			if mongoErr.Code == 286 || mongoErr.Code == 280 {
-				// Resume of change stream was not possible, reset offset
-				resumeToken.ResumeToken = ""
-				resumeToken.Timestamp = time.Time{}
-				err = c.tokenManager.SetOffset(ctx, *resumeToken)
-				if err != nil {
-					return nil, err
-				}
-				streamOptions.SetStartAfter(nil)
-				streamOptions.SetStartAtOperationTime(nil)
-				return c.getStream(ctx, streamOptions)
+	stream, err := c.watch(ctx, streamOptions)
+	if err == nil {
+		start.opened()
+	}
+	if err != nil && resumeToken != nil && *resumeToken != (StreamOffset{}) {
+		var mongoErr mongo.CommandError
+		if errors.As(err, &mongoErr) && (mongoErr.Code == 286 || mongoErr.Code == 280) {
+			streamOptions.SetStartAfter(nil)
+			streamOptions.SetStartAtOperationTime(nil)
+			if restarted {
+				// the invalidate event cannot be resumed, start from the stored offset
+				start.opened()
+				return c.getStream(ctx, start, streamOptions)
+			}
+			// Resume of change stream was not possible, reset offset
+			if err := c.tokenManager.SetOffset(ctx, StreamOffset{}); err != nil {
+				return nil, err
 			}
+			if c.onOffsetReset != nil {
+				c.onOffsetReset(ctx, *resumeToken, mongoErr)
+			}
+			return c.getStream(ctx, start, streamOptions)
 		}
 	}
 	return stream, err
 }
+
+// ErrCollectionWithoutDatabase is returned when Config.Collection is set without Config.Database,
+// instead of watching the whole cluster.
+var ErrCollectionWithoutDatabase = errors.New("collection requires a database")
+
+// watch opens a change stream on the configured collection, database or cluster.
+func (c *Consumer[T, K]) watch(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder) (*mongo.ChangeStream, error) {
+	switch {
+	case c.database == "":
+		return c.client.Watch(ctx, c.streamAggregation, streamOptions)
+	case c.collection == "":
+		return c.client.Database(c.database).Watch(ctx, c.streamAggregation, streamOptions)
+	default:
+		return c.client.Database(c.database).
+			Collection(c.collection).
+			Watch(ctx, c.streamAggregation, streamOptions)
+	}
+}
+
+// cloneStreamOptions returns a copy of given options, so that resume options set by
+// getStream do not leak between reconnects.
+func cloneStreamOptions(streamOptions *options.ChangeStreamOptionsBuilder) *options.ChangeStreamOptionsBuilder {
+	if streamOptions == nil {
+		return options.ChangeStream()
+	}
+	return &options.ChangeStreamOptionsBuilder{
+		Opts: slices.Clone(streamOptions.Opts),
+	}
+}
+
+// eventSource is the part of *mongo.ChangeStream read by the consumers, so that events can be fed without a server.
+type eventSource interface {
+	Next(ctx context.Context) bool
+	TryNext(ctx context.Context) bool
+	Decode(val any) error
+	Err() error
+	ID() int64
+	// Raw returns the current event.
+	Raw() bson.Raw
+}
+
+// changeStream adapts *mongo.ChangeStream to eventSource.
+type changeStream struct {
+	*mongo.ChangeStream
+}
+
+func (s changeStream) Raw() bson.Raw {
+	return s.Current
+}
+
+// decodeEvent decodes the current event of source into event, including its exact cluster time.
+func decodeEvent[T any, K any](source eventSource, event *StreamEvent[T, K]) error {
+	if err := source.Decode(event); err != nil {
+		return err
+	}
+	event.setClusterTimestamp(source.Raw())
+	return nil
+}
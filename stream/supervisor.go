@@ -0,0 +1,165 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Task is a consumer run by a Supervisor.
+type Task struct {
+	Name   string
+	run    func(ctx context.Context) StopStatus
+	offset func() *StreamOffset
+}
+
+// NewTask returns a Task which calls consumer.Run with streamOptions and handler.
+// Each consumer should have its own OffsetManager, e.g. NewMongoOffsetManager(coll, OffsetKey(name, ns), true).
+func NewTask[T any, K any](name string, consumer *Consumer[T, K], streamOptions *options.ChangeStreamOptionsBuilder, handler HandlerFn[T, K]) Task {
+	return Task{
+		Name: name,
+		run: func(ctx context.Context) StopStatus {
+			return consumer.Run(ctx, streamOptions, handler)
+		},
+		offset: consumer.lastCommitted,
+	}
+}
+
+// OffsetKey returns the key of the offsets of the consumer name watching ns.
+func OffsetKey(name string, ns Namespace) string {
+	return fmt.Sprintf("%s/%s.%s", name, ns.DB, ns.Coll)
+}
+
+// TaskState is the state of a Task.
+type TaskState string
+
+const (
+	TaskStarting TaskState = "starting"
+	TaskRunning  TaskState = "running"
+	TaskStopped  TaskState = "stopped"
+	TaskFailed   TaskState = "failed"
+)
+
+// TaskHealth is the health of a Task.
+type TaskHealth struct {
+	State     TaskState
+	StartedAt time.Time
+	// Offset is the last offset committed by the task.
+	Offset *StreamOffset
+	// Status is set once the task stopped.
+	Status *StopStatus
+}
+
+// Health is the health of the tasks of a Supervisor.
+type Health struct {
+	// Healthy is true while every task is running.
+	Healthy bool
+	Tasks   map[string]TaskHealth
+}
+
+// SupervisorConfig configures a Supervisor.
+type SupervisorConfig struct {
+	// ContinueOnError keeps the other tasks running when a task stops on its own,
+	// by default all the tasks are stopped.
+	ContinueOnError bool
+	// OnError, if set, is called when a task stops because of an error or an invalidated stream.
+	OnError func(ctx context.Context, task string, err error)
+}
+
+// Supervisor runs several consumers with a shared lifecycle, health status and error reporting.
+type Supervisor struct {
+	tasks           []Task
+	continueOnError bool
+	onError         func(ctx context.Context, task string, err error)
+
+	mu     sync.Mutex
+	health map[string]*TaskHealth
+}
+
+// NewSupervisor returns a Supervisor of tasks, which must have unique names.
+func NewSupervisor(conf SupervisorConfig, tasks ...Task) (*Supervisor, error) {
+	health := make(map[string]*TaskHealth, len(tasks))
+	for _, task := range tasks {
+		if _, ok := health[task.Name]; ok {
+			return nil, fmt.Errorf("duplicate task %q", task.Name)
+		}
+		health[task.Name] = &TaskHealth{State: TaskStarting}
+	}
+	return &Supervisor{
+		tasks:           tasks,
+		continueOnError: conf.ContinueOnError,
+		onError:         conf.OnError,
+		health:          health,
+	}, nil
+}
+
+// Run runs all the tasks until ctx is done, or until a task stops unless ContinueOnError is set.
+// It returns nil if every task was shut down, otherwise the errors of the tasks which stopped on their own.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.tasks))
+	for i, task := range s.tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.update(task.Name, func(h *TaskHealth) {
+				h.State, h.StartedAt = TaskRunning, time.Now()
+			})
+			status := task.run(ctx)
+
+			state := TaskStopped
+			if status.Err != nil {
+				state = TaskFailed
+			}
+			s.update(task.Name, func(h *TaskHealth) {
+				h.State, h.Status = state, &status
+			})
+			if status.Reason == StopReasonShutdown {
+				return
+			}
+			errs[i] = fmt.Errorf("%s: %s", task.Name, status.Reason)
+			if status.Err != nil {
+				errs[i] = fmt.Errorf("%s: %w", task.Name, status.Err)
+				if s.onError != nil {
+					s.onError(ctx, task.Name, status.Err)
+				}
+			}
+			if !s.continueOnError {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *Supervisor) update(task string, fn func(h *TaskHealth)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.health[task])
+}
+
+// Health returns the current health of the tasks.
+func (s *Supervisor) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health := Health{Healthy: true, Tasks: make(map[string]TaskHealth, len(s.tasks))}
+	for _, task := range s.tasks {
+		h := *s.health[task.Name]
+		if task.offset != nil {
+			h.Offset = task.offset()
+		}
+		if h.State != TaskRunning {
+			health.Healthy = false
+		}
+		health.Tasks[task.Name] = h
+	}
+	return health
+}
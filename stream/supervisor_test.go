@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func blockingTask(name string) Task {
+	return Task{Name: name, run: func(ctx context.Context) StopStatus {
+		<-ctx.Done()
+		return StopStatus{Reason: StopReasonShutdown, Drained: true}
+	}}
+}
+
+func TestSupervisor_Run(t *testing.T) {
+	fail := errors.New("fail")
+	failing := Task{Name: "orders", run: func(ctx context.Context) StopStatus {
+		return StopStatus{Reason: StopReasonError, Err: fail}
+	}}
+
+	tests := []struct {
+		name            string
+		continueOnError bool
+		wantHealth      map[string]TaskState
+	}{
+		{
+			name:       "a failing task stops the others",
+			wantHealth: map[string]TaskState{"users": TaskStopped, "orders": TaskFailed},
+		},
+		{
+			name:            "other tasks keep running",
+			continueOnError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []string
+			s, err := NewSupervisor(SupervisorConfig{
+				ContinueOnError: tt.continueOnError,
+				OnError: func(ctx context.Context, task string, err error) {
+					reported = append(reported, task)
+				},
+			}, blockingTask("users"), failing)
+			if err != nil {
+				t.Fatalf("NewSupervisor() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- s.Run(ctx) }()
+
+			if tt.continueOnError {
+				waitForState(t, s, "orders", TaskFailed)
+				if got := s.Health(); got.Healthy || got.Tasks["users"].State != TaskRunning {
+					t.Errorf("Health() = %+v", got)
+				}
+				cancel()
+			}
+			runErr := <-done
+
+			if !errors.Is(runErr, fail) || !strings.HasPrefix(runErr.Error(), "orders: ") {
+				t.Errorf("Run() error = %v, want %v of orders", runErr, fail)
+			}
+			if len(reported) != 1 || reported[0] != "orders" {
+				t.Errorf("OnError reported %v, want [orders]", reported)
+			}
+			health := s.Health()
+			for name, state := range tt.wantHealth {
+				if health.Tasks[name].State != state {
+					t.Errorf("Health() %s = %s, want %s", name, health.Tasks[name].State, state)
+				}
+			}
+			if health.Tasks["orders"].Status == nil || health.Tasks["orders"].Status.Err != fail {
+				t.Errorf("Health() orders status = %+v", health.Tasks["orders"].Status)
+			}
+		})
+	}
+}
+
+func TestSupervisor_shutdown(t *testing.T) {
+	s, err := NewSupervisor(SupervisorConfig{}, blockingTask("users"), blockingTask("orders"))
+	if err != nil {
+		t.Fatalf("NewSupervisor() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	waitForState(t, s, "users", TaskRunning)
+	waitForState(t, s, "orders", TaskRunning)
+	if !s.Health().Healthy {
+		t.Errorf("Health() not healthy while all tasks run")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v, want nil on shutdown", err)
+	}
+
+	if _, err := NewSupervisor(SupervisorConfig{}, blockingTask("users"), blockingTask("users")); err == nil {
+		t.Errorf("NewSupervisor() expected error on duplicate task")
+	}
+}
+
+func waitForState(t *testing.T, s *Supervisor, task string, state TaskState) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Health().Tasks[task].State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("task %s did not reach state %s", task, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
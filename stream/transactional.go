@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TransactionRunner runs fn in a transaction, it is implemented by *transaction.MongoTransactionRunner.
+type TransactionRunner interface {
+	ExecSnapshot(ctx context.Context, fn func(ctx context.Context) (any, error)) (any, error)
+}
+
+var ErrTransactionalOffsetManager = errors.New("transactional mode requires a MongoOffsetManager")
+
+// ConsumeTransactional is like ConsumeHandler, but handler is called in a transaction opened by runner
+// and the event offset is saved within the same transaction, so that handler writes and offset are
+// committed atomically. handler must use the ctx it receives, which carries the session.
+// Config.TokenManager must be a *MongoOffsetManager on the same cluster; with a lease the transaction
+// fails with ErrLeaseLost if a newer holder committed, in monotonic mode a stale offset is not saved.
+// Dead lettered or skipped events have their offset committed outside of a transaction.
+func (c *Consumer[T, K]) ConsumeTransactional(ctx context.Context, streamOptions *options.ChangeStreamOptionsBuilder, runner TransactionRunner, handler HandlerFn[T, K]) error {
+	offsets, ok := c.tokenManager.(*MongoOffsetManager)
+	if !ok {
+		return ErrTransactionalOffsetManager
+	}
+	return c.run(ctx, func(ctx context.Context, start *streamStart) (bool, error) {
+		return c.consumeEvents(ctx, ctx, start, streamOptions, func(ctx context.Context, raw bson.Raw, event StreamEvent[T, K]) error {
+			return c.handleTransactional(ctx, raw, event, runner, offsets, handler)
+		})
+	})
+}
+
+// handleTransactional calls handler and saves the event offset in a transaction, applying the failure policy.
+func (c *Consumer[T, K]) handleTransactional(ctx context.Context, raw bson.Raw, event StreamEvent[T, K], runner TransactionRunner, offsets *MongoOffsetManager, handler HandlerFn[T, K]) error {
+	offset := *event.GetStreamOffset()
+	committed := false
+	err := c.callHandler(ctx, raw, event, func(ctx context.Context, event StreamEvent[T, K]) error {
+		_, err := runner.ExecSnapshot(ctx, func(ctx context.Context) (any, error) {
+			if err := handler(ctx, event); err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			err := offsets.SetOffset(ctx, offset)
+			c.meter().OffsetCommitted(time.Since(start), err)
+			return nil, err
+		})
+		committed = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !committed {
+		return c.commitOffset(ctx, offset)
+	}
+	c.mu.Lock()
+	c.committed = &offset
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,169 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/YoungAgency/mongo-wrapper/v2/transaction"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var _ TransactionRunner = (*transaction.MongoTransactionRunner)(nil)
+
+// recordingRunner runs functions like a transaction, keeping the writes only if fn succeeds
+// and no write aborted the transaction.
+type recordingRunner struct {
+	coll    *memoryCollection
+	commits int
+}
+
+type txKey struct{}
+
+func (r *recordingRunner) ExecSnapshot(ctx context.Context, fn func(ctx context.Context) (any, error)) (any, error) {
+	r.coll.mu.Lock()
+	backup := make(map[any]map[string]any, len(r.coll.docs))
+	for id, doc := range r.coll.docs {
+		backup[id] = make(map[string]any, len(doc))
+		for k, v := range doc {
+			backup[id][k] = v
+		}
+	}
+	r.coll.aborted = false
+	r.coll.mu.Unlock()
+
+	ctx = mongo.NewSessionContext(context.WithValue(ctx, txKey{}, true), &mongo.Session{})
+	res, err := fn(ctx)
+	r.coll.mu.Lock()
+	if err == nil && r.coll.aborted {
+		err = errors.New("transaction aborted")
+	}
+	r.coll.mu.Unlock()
+	if err != nil {
+		r.coll.mu.Lock()
+		for id := range r.coll.docs {
+			delete(r.coll.docs, id)
+		}
+		for id, doc := range backup {
+			r.coll.docs[id] = doc
+		}
+		r.coll.mu.Unlock()
+		return nil, err
+	}
+	r.commits++
+	return res, nil
+}
+
+func TestConsumer_handleTransactional(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	offsets := NewMongoOffsetManager(coll, "consumer", false)
+	runner := &recordingRunner{coll: coll}
+	sink := &recordingSink{}
+	metrics := NewMemoryMetrics()
+	c := &Consumer[any, any]{
+		tokenManager: offsets,
+		metrics:      metrics,
+		failure: FailurePolicy{
+			MaxAttempts: 2,
+			Backoff:     Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+			DeadLetter:  sink,
+		},
+	}
+
+	fail := errors.New("fail")
+	calls := 0
+	handler := func(ctx context.Context, event StreamEvent[any, any]) error {
+		if ctx.Value(txKey{}) == nil {
+			t.Errorf("handler called outside of the transaction")
+		}
+		calls++
+		if event.ID.Data == "2" || calls == 1 {
+			return fail
+		}
+		return nil
+	}
+	event := func(token string) StreamEvent[any, any] {
+		e := StreamEvent[any, any]{OperationType: OperationInsert}
+		e.ID.Data = token
+		return e
+	}
+
+	if err := c.handleTransactional(ctx, nil, event("1"), runner, offsets, handler); err != nil {
+		t.Fatalf("handleTransactional() error = %v", err)
+	}
+	if got, _ := offsets.GetOffset(ctx); got == nil || got.ResumeToken != "1" || runner.commits != 1 {
+		t.Errorf("GetOffset() = %+v after %d commits, want offset 1 committed in a single transaction", got, runner.commits)
+	}
+	if commits := metrics.Snapshot().CommitDurations; len(commits) != 1 {
+		t.Errorf("OffsetCommitted() called %d times, want once for the transaction", len(commits))
+	}
+
+	if err := c.handleTransactional(ctx, nil, event("2"), runner, offsets, handler); err != nil {
+		t.Fatalf("handleTransactional() error = %v", err)
+	}
+	if len(sink.letters) != 1 || !errors.Is(sink.letters[0].Err, fail) {
+		t.Errorf("dead letters = %+v, want event 2", sink.letters)
+	}
+	if got, _ := offsets.GetOffset(ctx); got.ResumeToken != "2" || runner.commits != 1 {
+		t.Errorf("GetOffset() = %+v, want offset 2 committed outside of a transaction", got)
+	}
+	if last := c.lastCommitted(); last == nil || last.ResumeToken != "2" {
+		t.Errorf("lastCommitted() = %+v, want offset 2", last)
+	}
+}
+
+func TestConsumer_handleTransactional_conditional(t *testing.T) {
+	ctx := context.Background()
+	coll := newMemoryCollection()
+	leases := newMemoryCollection()
+	lease := NewLease(leases, LeaseConfig{Name: "orders", Owner: "a", TTL: time.Hour})
+	lease.TryAcquire(ctx)
+	offsets := NewMongoOffsetManager(coll, "consumer", true).WithLease(lease)
+	runner := &recordingRunner{coll: coll}
+	sink := &recordingSink{}
+	c := &Consumer[any, any]{
+		tokenManager: offsets,
+		failure:      FailurePolicy{MaxAttempts: 1, DeadLetter: sink},
+	}
+	handler := func(ctx context.Context, event StreamEvent[any, any]) error {
+		_, err := coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: event.ID.Data}}, bson.D{{Key: "$set", Value: bson.D{{Key: "handled", Value: true}}}})
+		return err
+	}
+	event := func(token string, ts time.Time) StreamEvent[any, any] {
+		e := StreamEvent[any, any]{OperationType: OperationInsert, ClusterTime: ts}
+		e.ID.Data = token
+		return e
+	}
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+
+	if err := offsets.SetOffset(ctx, StreamOffset{ResumeToken: "2", Timestamp: ts.Add(time.Second)}); err != nil {
+		t.Fatalf("SetOffset() error = %v", err)
+	}
+	if err := c.handleTransactional(ctx, nil, event("1", ts), runner, offsets, handler); err != nil {
+		t.Fatalf("handleTransactional() error = %v, want stale offset skipped", err)
+	}
+	if got, _ := offsets.GetOffset(ctx); got.ResumeToken != "2" || runner.commits != 1 {
+		t.Errorf("GetOffset() = %+v after %d commits, want offset 2 kept and handler writes committed", got, runner.commits)
+	}
+
+	// a newer holder committed an offset
+	coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: "consumer"}}, bson.D{{Key: "$set", Value: bson.D{{Key: "fence", Value: int64(2)}}}})
+	err := c.handleTransactional(ctx, nil, event("3", ts.Add(2*time.Second)), runner, offsets, handler)
+	if !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("handleTransactional() error = %v, want %v", err, ErrLeaseLost)
+	}
+	if len(sink.letters) != 0 || runner.commits != 1 {
+		t.Errorf("dead letters = %+v after %d commits, want none", sink.letters, runner.commits)
+	}
+}
+
+func TestConsumer_ConsumeTransactional_offsetManager(t *testing.T) {
+	c := &Consumer[any, any]{tokenManager: NewMemoryOffsetManager(nil)}
+	err := c.ConsumeTransactional(context.Background(), nil, &recordingRunner{}, nil)
+	if !errors.Is(err, ErrTransactionalOffsetManager) {
+		t.Errorf("ConsumeTransactional() error = %v, want %v", err, ErrTransactionalOffsetManager)
+	}
+}
@@ -0,0 +1,323 @@
+package stream
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DecodeUpdatedFields decodes ud.UpdatedFields into a T, expanding dotted keys such as
+// "address.city" or "items.3.qty" into nested documents and arrays.
+// Fields which were not updated are left to their zero value, use TouchedFields to know which ones were set.
+// Array elements before an updated index are zero values too.
+func DecodeUpdatedFields[T any](ud UpdateDescription) (T, error) {
+	var out T
+	doc, _, err := expandUpdatedFields(reflect.TypeOf(out), ud.UpdatedFields)
+	if err != nil {
+		return out, err
+	}
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return out, err
+	}
+	if err := bson.Unmarshal(b, &out); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// TouchedFields returns the Go paths of the fields of T set by ud.UpdatedFields, e.g. "Address.City" or "Items[3].Qty".
+// Updated keys which do not exist in T are ignored.
+func TouchedFields[T any](ud UpdateDescription) ([]string, error) {
+	var zero T
+	_, touched, err := expandUpdatedFields(reflect.TypeOf(zero), ud.UpdatedFields)
+	return touched, err
+}
+
+// expandUpdatedFields builds a nested document from dotted keys, following the shape of t.
+func expandUpdatedFields(t reflect.Type, fields map[string]interface{}) (map[string]any, []string, error) {
+	if t == nil || indirectType(t).Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("cannot decode updated fields into %v, type must be struct", t)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var root any = map[string]any{}
+	touched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		node, goPath, ok := setPath(root, t, strings.Split(key, "."), fields[key])
+		if !ok {
+			continue
+		}
+		root = node
+		touched = append(touched, goPath)
+	}
+	return root.(map[string]any), touched, nil
+}
+
+// setPath sets value at path inside node, which holds a value of type t.
+// It returns the updated node, the Go path of the value and false if path does not exist in t.
+func setPath(node any, t reflect.Type, path []string, value any) (any, string, bool) {
+	if len(path) == 0 {
+		return value, "", true
+	}
+	t = indirectType(t)
+	segment := path[0]
+	switch t.Kind() {
+	case reflect.Struct:
+		field, ok := fieldByBSONName(t, segment)
+		if !ok {
+			return node, "", false
+		}
+		doc, _ := node.(map[string]any)
+		if doc == nil {
+			doc = map[string]any{}
+		}
+		child, goPath, ok := setPath(doc[segment], field.Type, path[1:], value)
+		if !ok {
+			return node, "", false
+		}
+		doc[segment] = child
+		return doc, joinGoPath(field.Name, goPath), true
+	case reflect.Map, reflect.Interface:
+		doc, _ := node.(map[string]any)
+		if doc == nil {
+			doc = map[string]any{}
+		}
+		elem := t
+		if t.Kind() == reflect.Map {
+			elem = t.Elem()
+		}
+		child, goPath, ok := setPath(doc[segment], elem, path[1:], value)
+		if !ok {
+			return node, "", false
+		}
+		doc[segment] = child
+		return doc, joinGoPath("["+segment+"]", goPath), true
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || (t.Kind() == reflect.Array && i >= t.Len()) {
+			return node, "", false
+		}
+		arr, _ := node.([]any)
+		for len(arr) <= i {
+			arr = append(arr, nil)
+		}
+		child, goPath, ok := setPath(arr[i], t.Elem(), path[1:], value)
+		if !ok {
+			return node, "", false
+		}
+		arr[i] = child
+		return arr, joinGoPath("["+segment+"]", goPath), true
+	default:
+		return node, "", false
+	}
+}
+
+// fieldByBSONName returns the field of struct t encoded with given bson key, inline structs are searched too.
+func fieldByBSONName(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("bson"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if strings.Contains(opts, "inline") && indirectType(f.Type).Kind() == reflect.Struct {
+			if inner, ok := fieldByBSONName(indirectType(f.Type), key); ok {
+				return inner, true
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if name == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinGoPath(name, rest string) string {
+	if rest == "" || strings.HasPrefix(rest, "[") {
+		return name + rest
+	}
+	return name + "." + rest
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// ApplyUpdate returns the document obtained applying ud to prev, which is not modified.
+// Truncated arrays are applied first, then removed fields and finally updated fields in key order,
+// so that the same inputs always produce the same document.
+func ApplyUpdate(prev bson.D, ud UpdateDescription) (bson.D, error) {
+	var doc bson.D
+	b, err := bson.Marshal(prev)
+	if err != nil {
+		return nil, err
+	}
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	var node any = doc
+	for _, truncated := range ud.TruncatedArrays {
+		node, err = modify(node, strings.Split(truncated.Field, "."), false, func(value any, exists bool) (any, bool, error) {
+			arr, ok := value.(bson.A)
+			if !exists || !ok {
+				return value, exists, fmt.Errorf("cannot truncate %s, field is not an array", truncated.Field)
+			}
+			if truncated.NewSize < len(arr) {
+				arr = arr[:truncated.NewSize]
+			}
+			return arr, true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, removed := range ud.RemovedFields {
+		node, err = modify(node, strings.Split(removed, "."), false, func(value any, exists bool) (any, bool, error) {
+			return nil, false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(ud.UpdatedFields))
+	for key := range ud.UpdatedFields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		node, err = modify(node, strings.Split(key, "."), true, func(value any, exists bool) (any, bool, error) {
+			return ud.UpdatedFields[key], true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node.(bson.D), nil
+}
+
+// ApplyUpdateTo is like ApplyUpdate for a typed document.
+func ApplyUpdateTo[T any](prev T, ud UpdateDescription) (T, error) {
+	var out T
+	b, err := bson.Marshal(prev)
+	if err != nil {
+		return out, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return out, err
+	}
+	doc, err = ApplyUpdate(doc, ud)
+	if err != nil {
+		return out, err
+	}
+	b, err = bson.Marshal(doc)
+	if err != nil {
+		return out, err
+	}
+	err = bson.Unmarshal(b, &out)
+	return out, err
+}
+
+// modify replaces the value at path inside node with the one returned by fn, which also tells
+// whether the value must be kept. If create is true missing documents along path are created.
+func modify(node any, path []string, create bool, fn func(value any, exists bool) (any, bool, error)) (any, error) {
+	segment := path[0]
+	switch n := node.(type) {
+	case bson.D:
+		i := slices.IndexFunc(n, func(e bson.E) bool { return e.Key == segment })
+		var current any
+		if i >= 0 {
+			current = n[i].Value
+		}
+		if len(path) > 1 {
+			if i < 0 && !create {
+				return n, nil
+			}
+			if i < 0 {
+				current = bson.D{}
+			}
+			child, err := modify(current, path[1:], create, fn)
+			if err != nil {
+				return n, err
+			}
+			if i < 0 {
+				return append(n, bson.E{Key: segment, Value: child}), nil
+			}
+			n[i].Value = child
+			return n, nil
+		}
+		value, keep, err := fn(current, i >= 0)
+		if err != nil {
+			return n, err
+		}
+		switch {
+		case !keep && i >= 0:
+			return slices.Delete(n, i, i+1), nil
+		case !keep:
+			return n, nil
+		case i >= 0:
+			n[i].Value = value
+			return n, nil
+		default:
+			return append(n, bson.E{Key: segment, Value: value}), nil
+		}
+	case bson.A:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 {
+			return n, fmt.Errorf("cannot use %q as array index", segment)
+		}
+		if i >= len(n) && !create {
+			return n, nil
+		}
+		for len(n) <= i {
+			n = append(n, nil)
+		}
+		if len(path) > 1 {
+			current := n[i]
+			if current == nil {
+				current = bson.D{}
+			}
+			child, err := modify(current, path[1:], create, fn)
+			if err != nil {
+				return n, err
+			}
+			n[i] = child
+			return n, nil
+		}
+		value, keep, err := fn(n[i], true)
+		if err != nil {
+			return n, err
+		}
+		if !keep {
+			// unset array elements are set to null
+			value = nil
+		}
+		n[i] = value
+		return n, nil
+	default:
+		if !create {
+			return node, nil
+		}
+		return node, fmt.Errorf("cannot set %q inside a non document value", segment)
+	}
+}
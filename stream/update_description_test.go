@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type testAddress struct {
+	City string `bson:"city"`
+	Zip  string `bson:"zip"`
+}
+
+type testItem struct {
+	SKU string `bson:"sku"`
+	Qty int    `bson:"qty"`
+}
+
+type Versioned struct {
+	Version int `bson:"version"`
+}
+
+type testOrderDoc struct {
+	Versioned `bson:",inline"`
+	Name      string            `bson:"name"`
+	Address   *testAddress      `bson:"address"`
+	Items     []testItem        `bson:"items"`
+	Tags      map[string]string `bson:"tags"`
+	Status    string
+}
+
+func TestDecodeUpdatedFields(t *testing.T) {
+	ud := UpdateDescription{
+		UpdatedFields: map[string]interface{}{
+			"name":         "john",
+			"address.city": "Rome",
+			"items.1.qty":  int32(3),
+			"tags.color":   "red",
+			"version":      int32(2),
+			"status":       "done",
+			"unknown.path": "ignored",
+		},
+	}
+	got, err := DecodeUpdatedFields[testOrderDoc](ud)
+	if err != nil {
+		t.Fatalf("DecodeUpdatedFields() error = %v", err)
+	}
+	want := testOrderDoc{
+		Versioned: Versioned{Version: 2},
+		Name:      "john",
+		Address:   &testAddress{City: "Rome"},
+		Items:     []testItem{{}, {Qty: 3}},
+		Tags:      map[string]string{"color": "red"},
+		Status:    "done",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeUpdatedFields() = %+v, want %+v", got, want)
+	}
+
+	touched, err := TouchedFields[testOrderDoc](ud)
+	if err != nil {
+		t.Fatalf("TouchedFields() error = %v", err)
+	}
+	wantTouched := []string{"Address.City", "Items[1].Qty", "Name", "Status", "Tags[color]", "Version"}
+	if !reflect.DeepEqual(touched, wantTouched) {
+		t.Errorf("TouchedFields() = %v, want %v", touched, wantTouched)
+	}
+}
+
+func TestDecodeUpdatedFields_errors(t *testing.T) {
+	ud := UpdateDescription{UpdatedFields: map[string]interface{}{"name": int32(1)}}
+	if _, err := DecodeUpdatedFields[testOrderDoc](ud); err == nil {
+		t.Errorf("DecodeUpdatedFields() expected type mismatch error")
+	}
+	if _, err := DecodeUpdatedFields[string](ud); err == nil {
+		t.Errorf("DecodeUpdatedFields() expected error for non struct type")
+	}
+}
+
+func TestDecodeUpdatedFields_wholeValues(t *testing.T) {
+	ud := UpdateDescription{
+		UpdatedFields: map[string]interface{}{
+			"address": bson.D{{Key: "city", Value: "Milan"}, {Key: "zip", Value: "20100"}},
+			"items":   bson.A{bson.D{{Key: "sku", Value: "a"}, {Key: "qty", Value: int32(1)}}},
+		},
+	}
+	got, err := DecodeUpdatedFields[*testOrderDoc](ud)
+	if err != nil {
+		t.Fatalf("DecodeUpdatedFields() error = %v", err)
+	}
+	if got.Address == nil || got.Address.Zip != "20100" || len(got.Items) != 1 || got.Items[0].SKU != "a" {
+		t.Errorf("DecodeUpdatedFields() = %+v", got)
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	prev := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "name", Value: "john"},
+		{Key: "nickname", Value: "jj"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Rome"}, {Key: "zip", Value: "00100"}}},
+		{Key: "items", Value: bson.A{
+			bson.D{{Key: "sku", Value: "a"}, {Key: "qty", Value: int32(1)}},
+			bson.D{{Key: "sku", Value: "b"}, {Key: "qty", Value: int32(2)}},
+			bson.D{{Key: "sku", Value: "c"}, {Key: "qty", Value: int32(3)}},
+		}},
+	}
+	ud := UpdateDescription{
+		UpdatedFields: map[string]interface{}{
+			"name":         "jack",
+			"address.city": "Milan",
+			"items.1.qty":  int32(5),
+			"meta.source":  "import",
+		},
+		RemovedFields:   []string{"nickname", "address.zip", "missing.field"},
+		TruncatedArrays: []TruncatedArrayElement{{Field: "items", NewSize: 2}},
+	}
+	got, err := ApplyUpdate(prev, ud)
+	if err != nil {
+		t.Fatalf("ApplyUpdate() error = %v", err)
+	}
+	want := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "name", Value: "jack"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Milan"}}},
+		{Key: "items", Value: bson.A{
+			bson.D{{Key: "sku", Value: "a"}, {Key: "qty", Value: int32(1)}},
+			bson.D{{Key: "sku", Value: "b"}, {Key: "qty", Value: int32(5)}},
+		}},
+		{Key: "meta", Value: bson.D{{Key: "source", Value: "import"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyUpdate() = %v, want %v", got, want)
+	}
+	if prev[1].Value != "john" || len(prev) != 5 {
+		t.Errorf("ApplyUpdate() modified previous document")
+	}
+}
+
+func TestApplyUpdate_errors(t *testing.T) {
+	prev := bson.D{{Key: "name", Value: "john"}}
+	if _, err := ApplyUpdate(prev, UpdateDescription{TruncatedArrays: []TruncatedArrayElement{{Field: "name", NewSize: 0}}}); err == nil {
+		t.Errorf("ApplyUpdate() expected error truncating a non array field")
+	}
+	if _, err := ApplyUpdate(prev, UpdateDescription{UpdatedFields: map[string]interface{}{"name.first": "j"}}); err == nil {
+		t.Errorf("ApplyUpdate() expected error setting a field inside a string")
+	}
+}
+
+func TestApplyUpdateTo(t *testing.T) {
+	prev := testOrderDoc{
+		Name:    "john",
+		Address: &testAddress{City: "Rome", Zip: "00100"},
+		Items:   []testItem{{SKU: "a", Qty: 1}},
+	}
+	got, err := ApplyUpdateTo(prev, UpdateDescription{
+		UpdatedFields: map[string]interface{}{"items.1": bson.D{{Key: "sku", Value: "b"}, {Key: "qty", Value: int32(2)}}},
+		RemovedFields: []string{"address"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyUpdateTo() error = %v", err)
+	}
+	want := testOrderDoc{
+		Name:  "john",
+		Items: []testItem{{SKU: "a", Qty: 1}, {SKU: "b", Qty: 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyUpdateTo() = %+v, want %+v", got, want)
+	}
+}